@@ -0,0 +1,8 @@
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS timerange TEXT NOT NULL DEFAULT 'short';
+
+UPDATE accounts SET timerange = CASE
+  WHEN substring(schedule FROM '^0 0 1 1/([0-9]+) \*$')::int <= 1 THEN 'short'
+  WHEN substring(schedule FROM '^0 0 1 1/([0-9]+) \*$')::int <= 6 THEN 'medium'
+  ELSE 'long'
+END
+WHERE schedule ~ '^0 0 1 1/[0-9]+ \*$';
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE accounts DROP COLUMN IF EXISTS discovery_ratio;
+ALTER TABLE playlists DROP COLUMN IF EXISTS recommended;
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS discovery_ratio INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE playlists ADD COLUMN IF NOT EXISTS recommended TEXT[] NOT NULL DEFAULT '{}';
\ No newline at end of file
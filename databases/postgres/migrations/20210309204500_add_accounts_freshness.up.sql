@@ -0,0 +1 @@
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS freshness INTEGER NOT NULL DEFAULT 0;
\ No newline at end of file
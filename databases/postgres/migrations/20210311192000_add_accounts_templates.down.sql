@@ -0,0 +1,2 @@
+ALTER TABLE accounts DROP COLUMN IF EXISTS name_template;
+ALTER TABLE accounts DROP COLUMN IF EXISTS description_template;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE accounts DROP COLUMN IF EXISTS with_cover;
\ No newline at end of file
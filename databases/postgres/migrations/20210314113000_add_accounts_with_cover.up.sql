@@ -0,0 +1 @@
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS with_cover BOOLEAN NOT NULL DEFAULT TRUE;
\ No newline at end of file
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS playlist_versions;
+ALTER TABLE accounts DROP COLUMN IF EXISTS mode;
\ No newline at end of file
@@ -0,0 +1,13 @@
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS mode TEXT NOT NULL DEFAULT 'new';
+
+CREATE TABLE IF NOT EXISTS playlist_versions (
+  id UUID NOT NULL DEFAULT uuid_generate_v4(),
+  user_id TEXT NOT NULL,
+  name TEXT NOT NULL,
+  playlist_id TEXT NOT NULL,
+  tracks TEXT[] NOT NULL,
+  snapshot_id TEXT,
+  created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
\ No newline at end of file
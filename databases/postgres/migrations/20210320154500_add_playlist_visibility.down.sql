@@ -0,0 +1,2 @@
+ALTER TABLE accounts DROP COLUMN IF EXISTS visibility;
+ALTER TABLE users DROP COLUMN IF EXISTS scope;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE accounts DROP COLUMN IF EXISTS ordering;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS ordering TEXT NOT NULL DEFAULT 'rank';
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE accounts DROP COLUMN IF EXISTS source;
+ALTER TABLE accounts DROP COLUMN IF EXISTS artist_track_limit;
\ No newline at end of file
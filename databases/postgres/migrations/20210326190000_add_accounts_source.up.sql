@@ -0,0 +1,2 @@
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS source TEXT NOT NULL DEFAULT 'top-tracks';
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS artist_track_limit INTEGER NOT NULL DEFAULT 3;
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE accounts DROP COLUMN IF EXISTS genre_include;
+ALTER TABLE accounts DROP COLUMN IF EXISTS genre_exclude;
\ No newline at end of file
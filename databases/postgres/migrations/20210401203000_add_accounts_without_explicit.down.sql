@@ -0,0 +1 @@
+ALTER TABLE accounts DROP COLUMN IF EXISTS without_explicit;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS without_explicit BOOLEAN NOT NULL DEFAULT FALSE;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE playlists DROP COLUMN IF EXISTS build_step;
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE playlists ADD COLUMN IF NOT EXISTS build_step TEXT NOT NULL DEFAULT 'pending';
+UPDATE playlists SET build_step = 'finished' WHERE snapshot_id IS NOT NULL AND snapshot_id <> '';
\ No newline at end of file
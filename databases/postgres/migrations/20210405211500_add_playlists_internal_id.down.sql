@@ -0,0 +1,6 @@
+UPDATE playlist_versions v SET playlist_id = p.spotify_id FROM playlists p WHERE p.id::text = v.playlist_id;
+DROP INDEX IF EXISTS playlists_user_id_name_idx;
+ALTER TABLE playlists DROP CONSTRAINT IF EXISTS playlists_pkey;
+ALTER TABLE playlists DROP COLUMN IF EXISTS id;
+ALTER TABLE playlists RENAME COLUMN spotify_id TO id;
+ALTER TABLE playlists ADD PRIMARY KEY (name, user_id);
\ No newline at end of file
@@ -0,0 +1,6 @@
+ALTER TABLE playlists DROP CONSTRAINT IF EXISTS playlists_pkey;
+ALTER TABLE playlists RENAME COLUMN id TO spotify_id;
+ALTER TABLE playlists ADD COLUMN id UUID NOT NULL DEFAULT uuid_generate_v4();
+ALTER TABLE playlists ADD PRIMARY KEY (id);
+CREATE INDEX IF NOT EXISTS playlists_user_id_name_idx ON playlists (user_id, name);
+UPDATE playlist_versions v SET playlist_id = p.id::text FROM playlists p WHERE p.user_id = v.user_id AND p.name = v.name;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE playlists DROP COLUMN IF EXISTS build_failed;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE playlists ADD COLUMN IF NOT EXISTS build_failed BOOLEAN NOT NULL DEFAULT FALSE;
\ No newline at end of file
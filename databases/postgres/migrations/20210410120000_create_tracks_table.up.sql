@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS tracks (
+  id TEXT NOT NULL,
+  name TEXT NOT NULL,
+  artists TEXT NOT NULL,
+  album TEXT NOT NULL,
+  duration_ms INTEGER NOT NULL,
+  isrc TEXT NOT NULL,
+  preview_url TEXT NOT NULL,
+  artwork_url TEXT NOT NULL,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS tracks_updated_at_idx ON tracks (updated_at);
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS with_wrapped BOOLEAN NOT NULL DEFAULT FALSE;
\ No newline at end of file
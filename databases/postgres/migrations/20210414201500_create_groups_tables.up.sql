@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS groups (
+  id UUID NOT NULL DEFAULT uuid_generate_v4(),
+  owner_id TEXT NOT NULL,
+  name TEXT NOT NULL,
+  invite_code TEXT NOT NULL,
+  schedule TEXT NOT NULL,
+  track_limit INTEGER NOT NULL,
+  created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  UNIQUE (invite_code),
+  FOREIGN KEY (owner_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS group_members (
+  group_id UUID NOT NULL,
+  user_id TEXT NOT NULL,
+  created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (group_id, user_id),
+  FOREIGN KEY (group_id) REFERENCES groups (id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
\ No newline at end of file
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS leader_leases (
+  name TEXT NOT NULL,
+  holder TEXT NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL,
+  PRIMARY KEY (name)
+);
\ No newline at end of file
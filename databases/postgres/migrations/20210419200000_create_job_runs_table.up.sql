@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS job_runs (
+  id UUID NOT NULL DEFAULT uuid_generate_v4(),
+  user_id TEXT NOT NULL,
+  schedule TEXT NOT NULL,
+  status TEXT NOT NULL,
+  playlist_id TEXT NOT NULL DEFAULT '',
+  error TEXT NOT NULL DEFAULT '',
+  started_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  finished_at TIMESTAMPTZ,
+  PRIMARY KEY (id),
+  FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS job_runs_user_id_started_at_idx ON job_runs (user_id, started_at);
\ No newline at end of file
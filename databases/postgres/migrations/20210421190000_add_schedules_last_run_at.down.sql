@@ -0,0 +1 @@
+ALTER TABLE schedules DROP COLUMN IF EXISTS last_run_at;
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE playlist_versions DROP COLUMN IF EXISTS built_at;
+ALTER TABLE playlists DROP COLUMN IF EXISTS built_at;
\ No newline at end of file
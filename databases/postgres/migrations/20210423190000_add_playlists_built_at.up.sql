@@ -0,0 +1,13 @@
+ALTER TABLE playlists ADD COLUMN IF NOT EXISTS built_at TIMESTAMPTZ;
+ALTER TABLE playlist_versions ADD COLUMN IF NOT EXISTS built_at TIMESTAMPTZ;
+
+UPDATE playlist_versions v SET built_at = COALESCE(
+  (SELECT MAX(earlier.created_at) FROM playlist_versions earlier WHERE earlier.playlist_id = v.playlist_id AND earlier.created_at < v.created_at),
+  (SELECT p.created_at FROM playlists p WHERE p.id::text = v.playlist_id),
+  v.created_at
+);
+
+UPDATE playlists p SET built_at = COALESCE(
+  (SELECT MAX(v.created_at) FROM playlist_versions v WHERE v.playlist_id = p.id::text),
+  p.created_at
+) WHERE p.build_step = 'finished';
\ No newline at end of file
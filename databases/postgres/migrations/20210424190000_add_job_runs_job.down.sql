@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS job_runs_job_status_idx;
+ALTER TABLE job_runs DROP COLUMN IF EXISTS job;
\ No newline at end of file
@@ -0,0 +1,4 @@
+ALTER TABLE job_runs ADD COLUMN IF NOT EXISTS job TEXT NOT NULL DEFAULT '';
+UPDATE job_runs SET job = user_id WHERE job = '';
+
+CREATE INDEX IF NOT EXISTS job_runs_job_status_idx ON job_runs (job, status);
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE accounts DROP COLUMN IF EXISTS wrapped_run_at;
+ALTER TABLE groups DROP COLUMN IF EXISTS last_run_at;
\ No newline at end of file
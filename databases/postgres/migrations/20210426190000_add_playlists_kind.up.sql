@@ -0,0 +1,9 @@
+ALTER TABLE playlists ADD COLUMN IF NOT EXISTS kind TEXT NOT NULL DEFAULT 'personal';
+
+UPDATE playlists SET kind = 'wrapped' WHERE name ~ '^Spautofy Year in Review [0-9]+$';
+
+UPDATE playlists p SET kind = 'group'
+FROM groups g
+WHERE p.user_id = g.owner_id
+  AND left(p.name, length(g.name) + 2) = g.name || ': '
+  AND substring(p.name FROM length(g.name) + 3) ~ '^[A-Z][a-z]{2} [0-9]{4}$';
\ No newline at end of file
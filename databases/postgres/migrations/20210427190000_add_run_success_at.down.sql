@@ -0,0 +1,4 @@
+ALTER TABLE accounts DROP COLUMN IF EXISTS wrapped_success_at;
+ALTER TABLE groups DROP COLUMN IF EXISTS last_success_at;
+ALTER TABLE schedules DROP COLUMN IF EXISTS last_success_at;
+ALTER TABLE job_runs DROP COLUMN IF EXISTS due_at;
\ No newline at end of file
@@ -0,0 +1,19 @@
+ALTER TABLE job_runs ADD COLUMN IF NOT EXISTS due_at TIMESTAMPTZ;
+
+ALTER TABLE schedules ADD COLUMN IF NOT EXISTS last_success_at TIMESTAMPTZ;
+UPDATE schedules s SET last_success_at = (
+  SELECT MAX(r.started_at) FROM job_runs r WHERE r.job = s.user_id AND r.status = 'succeeded'
+);
+UPDATE schedules SET last_run_at = last_success_at;
+
+ALTER TABLE groups ADD COLUMN IF NOT EXISTS last_success_at TIMESTAMPTZ;
+UPDATE groups g SET last_success_at = (
+  SELECT MAX(r.started_at) FROM job_runs r WHERE r.job = 'group:' || g.id::text AND r.status = 'succeeded'
+);
+UPDATE groups SET last_run_at = last_success_at;
+
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS wrapped_success_at TIMESTAMPTZ;
+UPDATE accounts a SET wrapped_success_at = (
+  SELECT MAX(r.started_at) FROM job_runs r WHERE r.job = 'wrapped' AND r.user_id = a.user_id AND r.status = 'succeeded'
+);
+UPDATE accounts SET wrapped_run_at = wrapped_success_at;
\ No newline at end of file
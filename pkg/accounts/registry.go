@@ -17,18 +17,36 @@ var (
 )
 
 type Account struct {
-	UserID      string
-	Schedule    string
-	TrackLimit  int
-	WithConfirm bool
-	CreatedAt   time.Time
+	UserID              string
+	Schedule            string
+	TrackLimit          int
+	Timerange           string
+	DiscoveryRatio      int
+	Freshness           int
+	NameTemplate        string
+	DescriptionTemplate string
+	Mode                string
+	Visibility          string
+	Ordering            string
+	Source              string
+	ArtistTrackLimit    int
+	GenreInclude        pq.StringArray
+	GenreExclude        pq.StringArray
+	WithCover           bool
+	WithoutExplicit     bool
+	WithWrapped         bool
+	WithConfirm         bool
+	WrappedRunAt        *time.Time
+	WrappedSuccessAt    *time.Time
+	CreatedAt           time.Time
 }
 
-func NewAccount(userID, schedule string, trackLimit int, withConfirm bool) *Account {
+func NewAccount(userID, schedule string, trackLimit int, timerange string, withConfirm bool) *Account {
 	return &Account{
 		UserID:      userID,
 		Schedule:    schedule,
 		TrackLimit:  trackLimit,
+		Timerange:   timerange,
 		WithConfirm: withConfirm,
 	}
 }
@@ -47,7 +65,7 @@ func (r *Registry) Get(ctx context.Context, userID string) (*Account, error) {
 	var account Account
 	err := r.database.Transact(ctx, func(tx *sqlx.Tx) error {
 		query := `
-		SELECT user_id, schedule, track_limit, with_confirm, created_at
+		SELECT user_id, schedule, track_limit, timerange, discovery_ratio, freshness, name_template, description_template, mode, visibility, ordering, source, artist_track_limit, genre_include, genre_exclude, with_cover, without_explicit, with_wrapped, with_confirm, created_at
 		FROM accounts
 		WHERE user_id = $1
 		`
@@ -66,11 +84,40 @@ func (r *Registry) Get(ctx context.Context, userID string) (*Account, error) {
 	return &account, nil
 }
 
+func (r *Registry) ListWrapped(ctx context.Context) ([]*Account, error) {
+	var accounts []*Account
+	err := r.database.Transact(ctx, func(tx *sqlx.Tx) error {
+		query := `
+		SELECT user_id, schedule, track_limit, timerange, discovery_ratio, freshness, name_template, description_template, mode, visibility, ordering, source, artist_track_limit, genre_include, genre_exclude, with_cover, without_explicit, with_wrapped, with_confirm, wrapped_run_at, wrapped_success_at, created_at
+		FROM accounts
+		WHERE with_wrapped
+		`
+		rows, err := tx.QueryxContext(ctx, query)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var account Account
+			if err := rows.StructScan(&account); err != nil {
+				return err
+			}
+			accounts = append(accounts, &account)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return accounts, nil
+}
+
 func (r *Registry) Create(ctx context.Context, account *Account) (string, error) {
 	err := r.database.Transact(ctx, func(tx *sqlx.Tx) error {
 		query := `
-		INSERT INTO accounts (user_id, schedule, track_limit, with_confirm)
-		VALUES (:user_id, :schedule, :track_limit, :with_confirm)
+		INSERT INTO accounts (user_id, schedule, track_limit, timerange, discovery_ratio, freshness, name_template, description_template, mode, visibility, ordering, source, artist_track_limit, genre_include, genre_exclude, with_cover, without_explicit, with_wrapped, with_confirm)
+		VALUES (:user_id, :schedule, :track_limit, :timerange, :discovery_ratio, :freshness, :name_template, :description_template, :mode, :visibility, :ordering, :source, :artist_track_limit, :genre_include, :genre_exclude, :with_cover, :without_explicit, :with_wrapped, :with_confirm)
 		RETURNING user_id
 		`
 		stmt, err := tx.PrepareNamedContext(ctx, query)
@@ -96,12 +143,27 @@ func (r *Registry) Create(ctx context.Context, account *Account) (string, error)
 func (r *Registry) CreateOrUpdate(ctx context.Context, account *Account) (string, error) {
 	err := r.database.Transact(ctx, func(tx *sqlx.Tx) error {
 		query := `
-		INSERT INTO accounts (user_id, schedule, track_limit, with_confirm)
-		VALUES (:user_id, :schedule, :track_limit, :with_confirm)
+		INSERT INTO accounts (user_id, schedule, track_limit, timerange, discovery_ratio, freshness, name_template, description_template, mode, visibility, ordering, source, artist_track_limit, genre_include, genre_exclude, with_cover, without_explicit, with_wrapped, with_confirm)
+		VALUES (:user_id, :schedule, :track_limit, :timerange, :discovery_ratio, :freshness, :name_template, :description_template, :mode, :visibility, :ordering, :source, :artist_track_limit, :genre_include, :genre_exclude, :with_cover, :without_explicit, :with_wrapped, :with_confirm)
 		ON CONFLICT (user_id)
 		DO UPDATE SET
 			schedule = EXCLUDED.schedule,
 			track_limit = EXCLUDED.track_limit,
+			timerange = EXCLUDED.timerange,
+			discovery_ratio = EXCLUDED.discovery_ratio,
+			freshness = EXCLUDED.freshness,
+			name_template = EXCLUDED.name_template,
+			description_template = EXCLUDED.description_template,
+			mode = EXCLUDED.mode,
+			visibility = EXCLUDED.visibility,
+			ordering = EXCLUDED.ordering,
+			source = EXCLUDED.source,
+			artist_track_limit = EXCLUDED.artist_track_limit,
+			genre_include = EXCLUDED.genre_include,
+			genre_exclude = EXCLUDED.genre_exclude,
+			with_cover = EXCLUDED.with_cover,
+			without_explicit = EXCLUDED.without_explicit,
+			with_wrapped = EXCLUDED.with_wrapped,
 			with_confirm = EXCLUDED.with_confirm
 		RETURNING user_id
 		`
@@ -125,7 +187,22 @@ func (r *Registry) Update(ctx context.Context, account *Account) (string, error)
 		UPDATE accounts SET
 			schedule = :schedule,
 			track_limit = :track_limit,
-			with_confirm = :with_confirm,
+			timerange = :timerange,
+			discovery_ratio = :discovery_ratio,
+			freshness = :freshness,
+			name_template = :name_template,
+			description_template = :description_template,
+			mode = :mode,
+			visibility = :visibility,
+			ordering = :ordering,
+			source = :source,
+			artist_track_limit = :artist_track_limit,
+			genre_include = :genre_include,
+			genre_exclude = :genre_exclude,
+			with_cover = :with_cover,
+			without_explicit = :without_explicit,
+			with_wrapped = :with_wrapped,
+			with_confirm = :with_confirm
 		WHERE user_id = :user_id
 		RETURNING user_id
 		`
@@ -148,6 +225,58 @@ func (r *Registry) Update(ctx context.Context, account *Account) (string, error)
 	return account.UserID, nil
 }
 
+// ClaimWrapped records that the Year in Review due at due has been started for userID, reporting false when it, or
+// a later one, has already been claimed
+func (r *Registry) ClaimWrapped(ctx context.Context, userID string, due time.Time) (bool, error) {
+	err := r.database.Transact(ctx, func(tx *sqlx.Tx) error {
+		query := `
+		UPDATE accounts SET
+			wrapped_run_at = $2
+		WHERE user_id = $1 AND (wrapped_run_at IS NULL OR wrapped_run_at < $2)
+		RETURNING user_id
+		`
+		row := tx.QueryRowContext(ctx, query, userID, due)
+		return row.Scan(&userID)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// CompleteWrapped records that the user's Year in Review due at due succeeded, so it is not caught up again
+func (r *Registry) CompleteWrapped(ctx context.Context, userID string, due time.Time) error {
+	return r.database.Transact(ctx, func(tx *sqlx.Tx) error {
+		query := `
+		UPDATE accounts SET
+			wrapped_success_at = $2
+		WHERE user_id = $1 AND (wrapped_success_at IS NULL OR wrapped_success_at < $2)
+		`
+		_, err := tx.ExecContext(ctx, query, userID, due)
+		return err
+	})
+}
+
+// ReleaseWrapped gives up the claim on the user's Year in Review due at due after it failed, so that it can be
+// caught up later
+func (r *Registry) ReleaseWrapped(ctx context.Context, userID string, due time.Time) error {
+	return r.database.Transact(ctx, func(tx *sqlx.Tx) error {
+		query := `
+		UPDATE accounts SET
+			wrapped_run_at = wrapped_success_at
+		WHERE user_id = $1 AND wrapped_run_at = $2
+		`
+		_, err := tx.ExecContext(ctx, query, userID, due)
+		return err
+	})
+}
+
 func (r *Registry) Delete(ctx context.Context, userID string) error {
 	err := r.database.Transact(ctx, func(tx *sqlx.Tx) error {
 		query := `
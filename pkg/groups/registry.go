@@ -0,0 +1,346 @@
+package groups
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/jace-ys/go-library/postgres"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const (
+	inviteCodeLength = 16
+)
+
+var (
+	ErrGroupNotFound  = errors.New("group not found")
+	ErrMemberNotFound = errors.New("group member not found")
+)
+
+type Group struct {
+	ID            string
+	OwnerID       string
+	Name          string
+	InviteCode    string
+	Schedule      string
+	TrackLimit    int
+	LastRunAt     *time.Time
+	LastSuccessAt *time.Time
+	CreatedAt     time.Time
+}
+
+func NewGroup(ownerID, name, schedule string, trackLimit int) (*Group, error) {
+	code := make([]byte, inviteCodeLength)
+	if _, err := rand.Read(code); err != nil {
+		return nil, err
+	}
+
+	return &Group{
+		OwnerID:    ownerID,
+		Name:       name,
+		InviteCode: hex.EncodeToString(code),
+		Schedule:   schedule,
+		TrackLimit: trackLimit,
+	}, nil
+}
+
+type Member struct {
+	GroupID   string
+	UserID    string
+	CreatedAt time.Time
+}
+
+type Registry struct {
+	database *postgres.Client
+}
+
+func NewRegistry(postgres *postgres.Client) *Registry {
+	return &Registry{
+		database: postgres,
+	}
+}
+
+func (r *Registry) Get(ctx context.Context, id string) (*Group, error) {
+	var group Group
+	err := r.database.Transact(ctx, func(tx *sqlx.Tx) error {
+		query := `
+		SELECT id, owner_id, name, invite_code, schedule, track_limit, last_run_at, last_success_at, created_at
+		FROM groups
+		WHERE id = $1
+		`
+		row := tx.QueryRowxContext(ctx, query, id)
+		return row.StructScan(&group)
+	})
+	if err != nil {
+		var pqErr *pq.Error
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrGroupNotFound
+		case errors.As(err, &pqErr) && pqErr.Code.Name() == "invalid_text_representation":
+			return nil, ErrGroupNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &group, nil
+}
+
+func (r *Registry) GetByInviteCode(ctx context.Context, code string) (*Group, error) {
+	var group Group
+	err := r.database.Transact(ctx, func(tx *sqlx.Tx) error {
+		query := `
+		SELECT id, owner_id, name, invite_code, schedule, track_limit, last_run_at, last_success_at, created_at
+		FROM groups
+		WHERE invite_code = $1
+		`
+		row := tx.QueryRowxContext(ctx, query, code)
+		return row.StructScan(&group)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrGroupNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &group, nil
+}
+
+func (r *Registry) List(ctx context.Context) ([]*Group, error) {
+	var groups []*Group
+	err := r.database.Transact(ctx, func(tx *sqlx.Tx) error {
+		query := `
+		SELECT id, owner_id, name, invite_code, schedule, track_limit, last_run_at, last_success_at, created_at
+		FROM groups
+		`
+		rows, err := tx.QueryxContext(ctx, query)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var group Group
+			if err := rows.StructScan(&group); err != nil {
+				return err
+			}
+			groups = append(groups, &group)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return groups, nil
+}
+
+func (r *Registry) ListForUser(ctx context.Context, userID string) ([]*Group, error) {
+	var groups []*Group
+	err := r.database.Transact(ctx, func(tx *sqlx.Tx) error {
+		query := `
+		SELECT g.id, g.owner_id, g.name, g.invite_code, g.schedule, g.track_limit, g.last_run_at, g.last_success_at, g.created_at
+		FROM groups g
+		JOIN group_members m ON m.group_id = g.id
+		WHERE m.user_id = $1
+		ORDER BY g.created_at ASC
+		`
+		rows, err := tx.QueryxContext(ctx, query, userID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var group Group
+			if err := rows.StructScan(&group); err != nil {
+				return err
+			}
+			groups = append(groups, &group)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return groups, nil
+}
+
+func (r *Registry) Create(ctx context.Context, group *Group) (string, error) {
+	err := r.database.Transact(ctx, func(tx *sqlx.Tx) error {
+		query := `
+		INSERT INTO groups (owner_id, name, invite_code, schedule, track_limit)
+		VALUES (:owner_id, :name, :invite_code, :schedule, :track_limit)
+		RETURNING id
+		`
+		stmt, err := tx.PrepareNamedContext(ctx, query)
+		if err != nil {
+			return err
+		}
+		row := stmt.QueryRowxContext(ctx, group)
+		if err := row.Scan(&group.ID); err != nil {
+			return err
+		}
+
+		// the owner is always a member, so their top tracks go into the blend too
+		query = `
+		INSERT INTO group_members (group_id, user_id)
+		VALUES ($1, $2)
+		`
+		_, err = tx.ExecContext(ctx, query, group.ID, group.OwnerID)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return group.ID, nil
+}
+
+func (r *Registry) Delete(ctx context.Context, id string) error {
+	var deleted string
+	err := r.database.Transact(ctx, func(tx *sqlx.Tx) error {
+		query := `
+		DELETE FROM groups
+		WHERE id = $1
+		RETURNING id
+		`
+		row := tx.QueryRowContext(ctx, query, id)
+		return row.Scan(&deleted)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrGroupNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ClaimRun records that the run of the group's schedule due at due has been started, reporting false when it, or a
+// later one, has already been claimed
+func (r *Registry) ClaimRun(ctx context.Context, id string, due time.Time) (bool, error) {
+	err := r.database.Transact(ctx, func(tx *sqlx.Tx) error {
+		query := `
+		UPDATE groups SET
+			last_run_at = $2
+		WHERE id = $1 AND (last_run_at IS NULL OR last_run_at < $2)
+		RETURNING id
+		`
+		row := tx.QueryRowContext(ctx, query, id, due)
+		return row.Scan(&id)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// CompleteRun records that the run of the group's schedule due at due succeeded, so it is not caught up again
+func (r *Registry) CompleteRun(ctx context.Context, id string, due time.Time) error {
+	return r.database.Transact(ctx, func(tx *sqlx.Tx) error {
+		query := `
+		UPDATE groups SET
+			last_success_at = $2
+		WHERE id = $1 AND (last_success_at IS NULL OR last_success_at < $2)
+		`
+		_, err := tx.ExecContext(ctx, query, id, due)
+		return err
+	})
+}
+
+// ReleaseRun gives up the claim on the run of the group's schedule due at due after it failed, so that it can be
+// caught up later
+func (r *Registry) ReleaseRun(ctx context.Context, id string, due time.Time) error {
+	return r.database.Transact(ctx, func(tx *sqlx.Tx) error {
+		query := `
+		UPDATE groups SET
+			last_run_at = last_success_at
+		WHERE id = $1 AND last_run_at = $2
+		`
+		_, err := tx.ExecContext(ctx, query, id, due)
+		return err
+	})
+}
+
+func (r *Registry) ListMembers(ctx context.Context, groupID string) ([]*Member, error) {
+	var members []*Member
+	err := r.database.Transact(ctx, func(tx *sqlx.Tx) error {
+		query := `
+		SELECT group_id, user_id, created_at
+		FROM group_members
+		WHERE group_id = $1
+		ORDER BY created_at ASC
+		`
+		rows, err := tx.QueryxContext(ctx, query, groupID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var member Member
+			if err := rows.StructScan(&member); err != nil {
+				return err
+			}
+			members = append(members, &member)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+func (r *Registry) AddMember(ctx context.Context, groupID, userID string) error {
+	return r.database.Transact(ctx, func(tx *sqlx.Tx) error {
+		query := `
+		INSERT INTO group_members (group_id, user_id)
+		VALUES ($1, $2)
+		ON CONFLICT (group_id, user_id)
+		DO NOTHING
+		`
+		_, err := tx.ExecContext(ctx, query, groupID, userID)
+		return err
+	})
+}
+
+func (r *Registry) RemoveMember(ctx context.Context, groupID, userID string) error {
+	var removed string
+	err := r.database.Transact(ctx, func(tx *sqlx.Tx) error {
+		query := `
+		DELETE FROM group_members
+		WHERE group_id = $1 AND user_id = $2
+		RETURNING user_id
+		`
+		row := tx.QueryRowContext(ctx, query, groupID, userID)
+		return row.Scan(&removed)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrMemberNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
@@ -1,8 +1,6 @@
 package mail
 
 import (
-	"strings"
-
 	"github.com/sendgrid/sendgrid-go"
 	"github.com/sendgrid/sendgrid-go/helpers/mail"
 
@@ -11,28 +9,40 @@ import (
 
 type Mailer interface {
 	SendNewPlaylistEmail(user *users.User, withConfirm bool, playlistURL, unsubscribeURL string) error
+	SendWrappedEmail(user *users.User, stats *WrappedStats, playlistURL, unsubscribeURL string) error
+}
+
+type WrappedStats struct {
+	Year      int
+	Playlists int
+	Tracks    int
+	TopTrack  string
+	TopArtist string
 }
 
 type SendGridConfig struct {
-	APIKey      string
-	SenderName  string
-	SenderEmail string
-	TemplateID  string
+	APIKey            string
+	SenderName        string
+	SenderEmail       string
+	TemplateID        string
+	WrappedTemplateID string
 }
 
 type SendGridMailer struct {
-	client      *sendgrid.Client
-	senderName  string
-	senderEmail string
-	templateID  string
+	client            *sendgrid.Client
+	senderName        string
+	senderEmail       string
+	templateID        string
+	wrappedTemplateID string
 }
 
 func NewSendGridMailer(cfg *SendGridConfig) *SendGridMailer {
 	return &SendGridMailer{
-		client:      sendgrid.NewSendClient(cfg.APIKey),
-		senderName:  cfg.SenderName,
-		senderEmail: cfg.SenderEmail,
-		templateID:  cfg.TemplateID,
+		client:            sendgrid.NewSendClient(cfg.APIKey),
+		senderName:        cfg.SenderName,
+		senderEmail:       cfg.SenderEmail,
+		templateID:        cfg.TemplateID,
+		wrappedTemplateID: cfg.WrappedTemplateID,
 	}
 }
 
@@ -45,16 +55,8 @@ func (m *SendGridMailer) SendNewPlaylistEmail(user *users.User, withConfirm bool
 	email.SetFrom(mail.NewEmail(m.senderName, m.senderEmail))
 	email.AddPersonalizations(p)
 
-	var firstName string
-	name := strings.SplitN(user.DisplayName, " ", 2)
-	if len(name) > 1 {
-		firstName = name[0]
-	} else {
-		firstName = user.DisplayName
-	}
-
 	email.SetTemplateID(m.templateID)
-	p.SetDynamicTemplateData("firstName", firstName)
+	p.SetDynamicTemplateData("firstName", user.FirstName())
 	p.SetDynamicTemplateData("withConfirm", withConfirm)
 	p.SetDynamicTemplateData("playlistLink", playlistURL)
 	p.SetDynamicTemplateData("unsubscribe", unsubscribeURL)
@@ -66,3 +68,37 @@ func (m *SendGridMailer) SendNewPlaylistEmail(user *users.User, withConfirm bool
 
 	return nil
 }
+
+func (m *SendGridMailer) SendWrappedEmail(user *users.User, stats *WrappedStats, playlistURL, unsubscribeURL string) error {
+	email := mail.NewV3Mail()
+
+	p := mail.NewPersonalization()
+	p.AddTos(mail.NewEmail(user.DisplayName, user.Email))
+
+	email.SetFrom(mail.NewEmail(m.senderName, m.senderEmail))
+	email.AddPersonalizations(p)
+
+	// without a dedicated template, the new playlist template still renders the link
+	templateID := m.wrappedTemplateID
+	if templateID == "" {
+		templateID = m.templateID
+	}
+
+	email.SetTemplateID(templateID)
+	p.SetDynamicTemplateData("firstName", user.FirstName())
+	p.SetDynamicTemplateData("withConfirm", false)
+	p.SetDynamicTemplateData("playlistLink", playlistURL)
+	p.SetDynamicTemplateData("unsubscribe", unsubscribeURL)
+	p.SetDynamicTemplateData("year", stats.Year)
+	p.SetDynamicTemplateData("playlistCount", stats.Playlists)
+	p.SetDynamicTemplateData("trackCount", stats.Tracks)
+	p.SetDynamicTemplateData("topTrack", stats.TopTrack)
+	p.SetDynamicTemplateData("topArtist", stats.TopArtist)
+
+	_, err := m.client.Send(email)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
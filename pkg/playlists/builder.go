@@ -3,15 +3,19 @@ package playlists
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net/http"
 	"net/url"
 	"path"
-	"strings"
 	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/zmb3/spotify"
 
+	"github.com/jace-ys/spautofy/pkg/accounts"
 	"github.com/jace-ys/spautofy/pkg/mail"
+	"github.com/jace-ys/spautofy/pkg/scheduler"
+	"github.com/jace-ys/spautofy/pkg/spotifyhttp"
 	"github.com/jace-ys/spautofy/pkg/users"
 )
 
@@ -21,25 +25,58 @@ const (
 	TimerangeLong   string = "long"
 )
 
+const (
+	BuildStepPending     string = "pending"
+	BuildStepCreating    string = "creating"
+	BuildStepCreated     string = "created"
+	BuildStepTracksAdded string = "tracks_added"
+	BuildStepFinished    string = "finished"
+)
+
+const (
+	MaxTrackLimit = 200
+
+	maxTracksBatchSize         = 50
+	maxPlaylistsPageSize       = 50
+	maxPlaylistTracksBatchSize = 100
+)
+
 var (
 	ErrPlaylistNoSpotifyURL = errors.New("no spotify url found for playlist")
 )
 
+func DefaultTimerange(frequency int) string {
+	switch {
+	case frequency >= 12:
+		return TimerangeShort
+	case frequency > 1:
+		return TimerangeMedium
+	default:
+		return TimerangeLong
+	}
+}
+
 type BuilderFactory struct {
 	baseURL       *url.URL
 	mailer        mail.Mailer
 	registry      *Registry
+	tracks        *TrackRegistry
 	users         *users.Registry
 	authenticator *spotify.Authenticator
+	transport     http.RoundTripper
+	genres        *genreCache
 }
 
-func NewBuilderFactory(baseURL *url.URL, mailer mail.Mailer, registry *Registry, users *users.Registry, authenticator *spotify.Authenticator) *BuilderFactory {
+func NewBuilderFactory(baseURL *url.URL, mailer mail.Mailer, registry *Registry, tracks *TrackRegistry, users *users.Registry, authenticator *spotify.Authenticator, transport http.RoundTripper) *BuilderFactory {
 	return &BuilderFactory{
 		baseURL:       baseURL,
 		mailer:        mailer,
 		registry:      registry,
+		tracks:        tracks,
 		users:         users,
 		authenticator: authenticator,
+		transport:     transport,
+		genres:        newGenreCache(genreCacheTTL),
 	}
 }
 
@@ -48,8 +85,10 @@ type Builder struct {
 	logger   log.Logger
 	mailer   mail.Mailer
 	registry *Registry
-	client   *spotify.Client
+	tracks   *TrackRegistry
+	client   Client
 	user     *users.User
+	genres   *genreCache
 }
 
 func (bf *BuilderFactory) NewBuilder(ctx context.Context, logger log.Logger, userID string) (*Builder, error) {
@@ -68,13 +107,15 @@ func (bf *BuilderFactory) NewBuilder(ctx context.Context, logger log.Logger, use
 		logger:   log.With(logger, "user", userID),
 		mailer:   bf.mailer,
 		registry: bf.registry,
+		tracks:   bf.tracks,
 		client:   client,
 		user:     user,
+		genres:   bf.genres,
 	}, nil
 }
 
 func (bf *BuilderFactory) ensureClient(ctx context.Context, user *users.User) (*spotify.Client, error) {
-	client := bf.authenticator.NewClient(user.Token)
+	client := spotifyhttp.NewClient(bf.authenticator, user.Token, bf.transport)
 
 	if time.Now().Sub(user.Token.Expiry) > 0 {
 		var err error
@@ -88,144 +129,333 @@ func (bf *BuilderFactory) ensureClient(ctx context.Context, user *users.User) (*
 			return nil, err
 		}
 
-		client = bf.authenticator.NewClient(user.Token)
+		client = spotifyhttp.NewClient(bf.authenticator, user.Token, bf.transport)
 	}
 
-	return &client, nil
+	return client, nil
 }
 
-func (b *Builder) Run(trackLimit int, withConfirm bool) func() {
-	return func() {
-		b.logger.Log("event", "playlist.build.started", "limit", trackLimit, "confirm", withConfirm)
+// Run builds the next playlist for account, returning the ID of the playlist it produced
+func (b *Builder) Run(ctx context.Context, account *accounts.Account) (string, error) {
+	b.logger.Log("event", "playlist.build.started", "limit", account.TrackLimit, "timerange", account.Timerange, "discovery", account.DiscoveryRatio, "freshness", account.Freshness, "mode", account.Mode, "visibility", account.Visibility, "ordering", account.Ordering, "source", account.Source, "clean", account.WithoutExplicit, "confirm", account.WithConfirm)
+
+	playlist, err := b.NewPlaylist(ctx, account)
+	if err != nil {
+		b.logger.Log("event", "playlist.new.failed", "error", err)
+		return "", fmt.Errorf("failed to select tracks: %w", err)
+	}
+
+	// the cache only saves later lookups, so a failure here should not stop the build
+	if err := b.cacheTracks(ctx, playlist.TrackIDs); err != nil {
+		b.logger.Log("event", "tracks.cache.failed", "error", err)
+	}
 
-		ctx, cancel := context.WithCancel(context.Background())
-		defer cancel()
+	var id string
+	switch account.Mode {
+	case ModeRolling:
+		id, err = b.prepareRolling(ctx, playlist)
+	default:
+		id, err = b.prepareNew(ctx, account, playlist)
+	}
+	if err != nil {
+		b.logger.Log("event", "playlist.create.failed", "error", err)
+		return "", fmt.Errorf("failed to create playlist: %w", err)
+	}
 
-		playlist, err := b.NewPlaylist(trackLimit, TimerangeShort)
+	var playlistURL string
+	if account.WithConfirm {
+		spautofyURL := *b.baseURL
+		spautofyURL.Path = path.Join(spautofyURL.Path, "accounts", b.user.ID, "playlists", playlist.ID)
+		playlistURL = spautofyURL.String()
+	} else {
+		err = b.Build(ctx, account, playlist)
 		if err != nil {
-			b.logger.Log("event", "playlist.new.failed", "error", err)
-			return
+			b.logger.Log("event", "playlist.build.failed", "error", err)
+			return playlist.ID, fmt.Errorf("failed to build playlist: %w", err)
 		}
 
-		id, err := b.registry.Create(ctx, playlist)
+		id = playlist.ID
+		playlistURL = playlist.SpotifyURL
+	}
+
+	accountURL := *b.baseURL
+	accountURL.Path = path.Join(accountURL.Path, "accounts", b.user.ID)
+
+	b.logger.Log("event", "playlist.build.finished", "id", id)
+
+	err = b.mailer.SendNewPlaylistEmail(b.user, account.WithConfirm, playlistURL, accountURL.String())
+	if err != nil {
+		b.logger.Log("event", "email.send.failed", "error", err)
+		return id, fmt.Errorf("failed to send email: %w", err)
+	}
+
+	b.logger.Log("event", "email.sent", "email", b.user.Email)
+
+	return id, nil
+}
+
+func (b *Builder) NewPlaylist(ctx context.Context, account *accounts.Account) (*Playlist, error) {
+	exclude := make(map[spotify.ID]bool)
+	if account.Freshness > 0 {
+		previous, err := b.registry.ListRecent(ctx, b.user.ID, account.Freshness)
 		if err != nil {
-			b.logger.Log("event", "playlist.create.failed", "error", err)
-			return
+			return nil, err
 		}
 
-		var playlistURL string
-		if withConfirm {
-			spautofyURL := *b.baseURL
-			spautofyURL.Path = path.Join(spautofyURL.Path, "accounts", b.user.ID, "playlists", playlist.Name)
-			playlistURL = spautofyURL.String()
-		} else {
-			err = b.Build(playlist)
-			if err != nil {
-				b.logger.Log("event", "playlist.build.failed", "error", err)
-				return
+		for _, playlist := range previous {
+			for _, id := range playlist.TrackIDs {
+				exclude[id] = true
 			}
+		}
+	}
 
-			id, err = b.registry.Update(ctx, playlist)
-			if err != nil {
-				b.logger.Log("event", "playlist.update.failed", "error", err)
-				return
-			}
+	source := b.trackSource(account)
+	trackIDs, err := source.Tracks(account.TrackLimit, account.Timerange, exclude)
+	if err != nil {
+		return nil, err
+	}
 
-			playlistURL = playlist.SpotifyURL
+	var recommendedIDs []spotify.ID
+	if account.DiscoveryRatio > 0 {
+		count := account.TrackLimit * account.DiscoveryRatio / 100
+
+		for _, id := range trackIDs {
+			exclude[id] = true
 		}
 
-		accountURL := *b.baseURL
-		accountURL.Path = path.Join(accountURL.Path, "accounts", b.user.ID)
+		recommendedIDs, err = b.recommend(trackIDs, account.Timerange, count, exclude)
+		if err != nil {
+			return nil, err
+		}
 
-		b.logger.Log("event", "playlist.build.finished", "id", id)
+		topCount := account.TrackLimit - len(recommendedIDs)
+		if topCount < len(trackIDs) {
+			trackIDs = trackIDs[:topCount]
+		}
+
+		trackIDs = blend(trackIDs, recommendedIDs)
+	}
 
-		err = b.mailer.SendNewPlaylistEmail(b.user, withConfirm, playlistURL, accountURL.String())
+	if account.WithoutExplicit {
+		trackIDs, recommendedIDs, err = b.cleanTracks(trackIDs, recommendedIDs)
 		if err != nil {
-			b.logger.Log("event", "email.send.failed", "error", err)
-			return
+			return nil, err
 		}
+	}
 
-		b.logger.Log("event", "email.sent", "email", b.user.Email)
+	trackIDs, err = b.order(trackIDs, account.Ordering)
+	if err != nil {
+		return nil, err
 	}
-}
 
-func (b *Builder) NewPlaylist(limit int, timerange string) (*Playlist, error) {
-	opts := &spotify.Options{
-		Limit:     &limit,
-		Timerange: &timerange,
+	topArtist, err := b.topArtist(account.Timerange)
+	if err != nil {
+		return nil, err
 	}
 
-	tracks, err := b.client.CurrentUsersTopTracksOpt(opts)
+	data := NewTemplateData(time.Now(), scheduler.SpecToDescription(account.Schedule), len(trackIDs), topArtist, b.user.FirstName())
+	name, description, err := data.RenderNameAndDescription(account.NameTemplate, account.DescriptionTemplate)
 	if err != nil {
 		return nil, err
 	}
 
-	trackIDs := make([]spotify.ID, len(tracks.Tracks))
-	for idx, track := range tracks.Tracks {
-		trackIDs[idx] = track.ID
+	if account.Mode == ModeRolling {
+		name = RollingPlaylistName
 	}
 
 	return &Playlist{
-		UserID:      b.user.ID,
-		Name:        time.Now().Format("Jan 2006"),
-		Description: "A playlist put together for you by Spautofy based on your recent top tracks.",
-		TrackIDs:    trackIDs,
+		UserID:         b.user.ID,
+		Kind:           KindPersonal,
+		Name:           name,
+		Description:    description,
+		TrackIDs:       trackIDs,
+		RecommendedIDs: recommendedIDs,
+		BuildStep:      BuildStepPending,
 	}, nil
 }
 
-func (b *Builder) Build(playlist *Playlist) error {
-	spotifyPlaylist, err := b.client.CreatePlaylistForUser(playlist.UserID, playlist.Name, playlist.Description, false)
-	if err != nil {
-		return err
+func (b *Builder) prepareNew(ctx context.Context, account *accounts.Account, playlist *Playlist) (string, error) {
+	// an unconfirmed playlist is still waiting on the user, so only a failed automatic build is picked back up
+	if !account.WithConfirm {
+		previous, err := b.registry.GetLatest(ctx, playlist.UserID, playlist.Name)
+		switch {
+		case errors.Is(err, ErrPlaylistNotFound):
+			// no-op
+		case err != nil:
+			return "", err
+		case previous.BuildStep != BuildStepFinished:
+			// a build that failed in an earlier period would bring back its stale tracks, so it is left behind
+			due := scheduler.GetPrevious(account.Schedule, time.Now())
+			if due.IsZero() || previous.CreatedAt.Before(due) {
+				b.logger.Log("event", "playlist.build.abandoned", "id", previous.ID, "step", previous.BuildStep)
+				break
+			}
+
+			b.logger.Log("event", "playlist.build.resumed", "id", previous.ID, "step", previous.BuildStep)
+			*playlist = *previous
+			return playlist.ID, nil
+		}
 	}
 
-	snapshotID, err := b.client.AddTracksToPlaylist(spotifyPlaylist.ID, playlist.TrackIDs...)
+	return b.registry.Create(ctx, playlist)
+}
+
+func (b *Builder) Build(ctx context.Context, account *accounts.Account, playlist *Playlist) error {
+	err := b.build(ctx, account, playlist)
 	if err != nil {
+		playlist.BuildFailed = true
+		if _, err := b.registry.Update(ctx, playlist); err != nil {
+			b.logger.Log("event", "playlist.update.failed", "error", err)
+		}
 		return err
 	}
 
-	var ok bool
-	playlist.SpotifyURL, ok = spotifyPlaylist.ExternalURLs["spotify"]
-	if !ok {
-		return ErrPlaylistNoSpotifyURL
+	return nil
+}
+
+func (b *Builder) build(ctx context.Context, account *accounts.Account, playlist *Playlist) error {
+	period := playlist.CreatedAt
+	if period.IsZero() || account.Mode == ModeRolling {
+		period = time.Now()
+	}
+
+	// each step is saved once completed, so a retried build resumes where the last one stopped
+	if playlist.BuildStep == BuildStepPending || playlist.BuildStep == BuildStepCreating {
+		var id spotify.ID
+		var err error
+		if playlist.BuildStep == BuildStepCreating {
+			// an earlier attempt stopped between creating the playlist and recording it, so it might already exist
+			id, err = b.findOrphan(playlist)
+		} else {
+			// the intent is recorded first, so only a retry of an interrupted creation goes looking for an orphan
+			err = b.advance(ctx, playlist, BuildStepCreating)
+		}
+		if err != nil {
+			return err
+		}
+
+		if id == "" {
+			spotifyPlaylist, err := b.createForUser(playlist, b.visibility(account))
+			if err != nil {
+				return err
+			}
+			id = spotifyPlaylist.ID
+		}
+
+		playlist.SpotifyID = id
+		err = b.advance(ctx, playlist, BuildStepCreated)
+		if err != nil {
+			return err
+		}
 	}
 
-	playlist.ID = spotifyPlaylist.ID
-	playlist.SnapshotID = snapshotID
+	if playlist.BuildStep == BuildStepCreated {
+		err := b.replaceTracks(playlist.SpotifyID, playlist.TrackIDs)
+		if err != nil {
+			return err
+		}
+
+		err = b.advance(ctx, playlist, BuildStepTracksAdded)
+		if err != nil {
+			return err
+		}
+	}
+
+	if playlist.BuildStep == BuildStepTracksAdded {
+		spotifyPlaylist, err := b.client.GetPlaylist(playlist.SpotifyID)
+		if err != nil {
+			return err
+		}
+
+		var ok bool
+		playlist.SpotifyURL, ok = spotifyPlaylist.ExternalURLs["spotify"]
+		if !ok {
+			return ErrPlaylistNoSpotifyURL
+		}
+		playlist.SnapshotID = spotifyPlaylist.SnapshotID
+
+		if account.WithCover {
+			// a missing cover should not fail an otherwise successful build
+			if err := b.uploadCover(playlist, period); err != nil {
+				b.logger.Log("event", "playlist.cover.failed", "error", err)
+			}
+		}
+
+		err = b.advance(ctx, playlist, BuildStepFinished)
+		if err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
 
-type Track struct {
-	ID         spotify.ID
-	Name       string
-	Artists    string
-	Album      string
-	PreviewURL string
+// findOrphan looks for an empty playlist left behind by an earlier attempt that got as far as creating it on Spotify,
+// but not as far as recording it
+func (b *Builder) findOrphan(playlist *Playlist) (spotify.ID, error) {
+	limit := maxPlaylistsPageSize
+	page, err := b.client.CurrentUsersPlaylistsOpt(&spotify.Options{Limit: &limit})
+	if err != nil {
+		return "", err
+	}
+
+	for _, p := range page.Playlists {
+		if p.Owner.ID == b.user.ID && p.Name == playlist.Name && p.Tracks.Total == 0 {
+			return p.ID, nil
+		}
+	}
+
+	return "", nil
 }
 
-func (b *Builder) FetchTracks(trackIDs []spotify.ID) ([]*Track, error) {
-	spotifyTracks, err := b.client.GetTracks(trackIDs...)
+func (b *Builder) advance(ctx context.Context, playlist *Playlist, step string) error {
+	playlist.BuildStep = step
+	playlist.BuildFailed = false
+
+	if step == BuildStepFinished {
+		builtAt := time.Now()
+		playlist.BuiltAt = &builtAt
+	}
+
+	_, err := b.registry.Update(ctx, playlist)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	tracks := make([]*Track, len(spotifyTracks))
-	for i, track := range spotifyTracks {
-		tracks[i] = &Track{
-			ID:         track.ID,
-			Name:       track.Name,
-			Album:      track.Album.Name,
-			PreviewURL: track.PreviewURL,
-		}
+	b.logger.Log("event", "playlist.build.advanced", "id", playlist.ID, "step", step)
+	return nil
+}
 
-		artists := make([]string, len(track.Artists))
-		for j, artist := range track.Artists {
-			artists[j] = artist.Name
+func (b *Builder) replaceTracks(playlistID spotify.ID, trackIDs []spotify.ID) error {
+	// Spotify only accepts up to 100 tracks per request, so any beyond that are appended afterwards
+	head, tail := trackIDs, []spotify.ID(nil)
+	if len(head) > maxPlaylistTracksBatchSize {
+		head, tail = head[:maxPlaylistTracksBatchSize], head[maxPlaylistTracksBatchSize:]
+	}
+
+	err := b.client.ReplacePlaylistTracks(playlistID, head...)
+	if err != nil {
+		return err
+	}
+
+	_, err = b.addTracks(playlistID, tail)
+	return err
+}
+
+func (b *Builder) addTracks(playlistID spotify.ID, trackIDs []spotify.ID) (string, error) {
+	var snapshotID string
+	for start := 0; start < len(trackIDs); start += maxPlaylistTracksBatchSize {
+		end := start + maxPlaylistTracksBatchSize
+		if end > len(trackIDs) {
+			end = len(trackIDs)
 		}
 
-		tracks[i].Artists = strings.Join(artists, ", ")
+		var err error
+		snapshotID, err = b.client.AddTracksToPlaylist(playlistID, trackIDs[start:end]...)
+		if err != nil {
+			return "", err
+		}
 	}
 
-	return tracks, nil
+	return snapshotID, nil
 }
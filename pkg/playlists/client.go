@@ -0,0 +1,27 @@
+package playlists
+
+import (
+	"io"
+
+	"github.com/zmb3/spotify"
+)
+
+type Client interface {
+	CurrentUsersTopTracksOpt(opt *spotify.Options) (*spotify.FullTrackPage, error)
+	CurrentUsersTopArtistsOpt(opt *spotify.Options) (*spotify.FullArtistPage, error)
+	CurrentUsersPlaylistsOpt(opt *spotify.Options) (*spotify.SimplePlaylistPage, error)
+	GetTracks(ids ...spotify.ID) ([]*spotify.FullTrack, error)
+	GetArtists(ids ...spotify.ID) ([]*spotify.FullArtist, error)
+	GetArtistsTopTracks(artistID spotify.ID, country string) ([]spotify.FullTrack, error)
+	GetArtistAlbumsOpt(artistID spotify.ID, opt *spotify.Options, ts ...spotify.AlbumType) (*spotify.SimpleAlbumPage, error)
+	GetAlbumTracks(id spotify.ID) (*spotify.SimpleTrackPage, error)
+	GetAudioFeatures(ids ...spotify.ID) ([]*spotify.AudioFeatures, error)
+	GetRecommendations(seeds spotify.Seeds, trackAttributes *spotify.TrackAttributes, opt *spotify.Options) (*spotify.Recommendations, error)
+	SearchOpt(query string, t spotify.SearchType, opt *spotify.Options) (*spotify.SearchResult, error)
+	CreatePlaylistForUser(userID, playlistName, description string, public bool) (*spotify.FullPlaylist, error)
+	CreateCollaborativePlaylistForUser(userID, playlistName, description string) (*spotify.FullPlaylist, error)
+	GetPlaylist(playlistID spotify.ID) (*spotify.FullPlaylist, error)
+	AddTracksToPlaylist(playlistID spotify.ID, trackIDs ...spotify.ID) (string, error)
+	ReplacePlaylistTracks(playlistID spotify.ID, trackIDs ...spotify.ID) error
+	SetPlaylistImage(playlistID spotify.ID, img io.Reader) error
+}
@@ -0,0 +1,119 @@
+package playlists
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zmb3/spotify"
+)
+
+const (
+	maxSearchResults = 10
+)
+
+func (b *Builder) cleanTracks(trackIDs, recommendedIDs []spotify.ID) ([]spotify.ID, []spotify.ID, error) {
+	tracks, err := fetchFullTracks(b.client, trackIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	recommended := make(map[spotify.ID]bool, len(recommendedIDs))
+	for _, id := range recommendedIDs {
+		recommended[id] = true
+	}
+
+	seen := make(map[spotify.ID]bool, len(tracks))
+	for _, track := range tracks {
+		seen[track.ID] = true
+	}
+
+	var cleanIDs, cleanRecommendedIDs []spotify.ID
+	var replaced, removed int
+	for _, track := range tracks {
+		id := track.ID
+		if track.Explicit {
+			clean, err := b.findClean(track)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			if clean == nil || seen[clean.ID] {
+				removed++
+				continue
+			}
+
+			seen[clean.ID] = true
+			id = clean.ID
+			replaced++
+		}
+
+		cleanIDs = append(cleanIDs, id)
+		if recommended[track.ID] {
+			cleanRecommendedIDs = append(cleanRecommendedIDs, id)
+		}
+	}
+
+	b.logger.Log("event", "playlist.explicit.filtered", "replaced", replaced, "removed", removed)
+
+	return cleanIDs, cleanRecommendedIDs, nil
+}
+
+func (b *Builder) findClean(track *spotify.FullTrack) (*spotify.FullTrack, error) {
+	// the same recording usually shares an ISRC across its explicit and clean releases
+	if isrc := track.ExternalIDs["isrc"]; isrc != "" {
+		clean, err := b.searchClean(track, fmt.Sprintf("isrc:%s", isrc))
+		if err != nil || clean != nil {
+			return clean, err
+		}
+	}
+
+	query := fmt.Sprintf("track:%q", track.Name)
+	if len(track.Artists) > 0 {
+		query += fmt.Sprintf(" artist:%q", track.Artists[0].Name)
+	}
+
+	return b.searchClean(track, query)
+}
+
+func (b *Builder) searchClean(track *spotify.FullTrack, query string) (*spotify.FullTrack, error) {
+	country := market
+	limit := maxSearchResults
+
+	result, err := b.client.SearchOpt(query, spotify.SearchTypeTrack, &spotify.Options{
+		Country: &country,
+		Limit:   &limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Tracks == nil {
+		return nil, nil
+	}
+
+	for _, candidate := range result.Tracks.Tracks {
+		if candidate.Explicit || candidate.ID == track.ID {
+			continue
+		}
+
+		if !strings.EqualFold(candidate.Name, track.Name) || !sameArtist(candidate, track) {
+			continue
+		}
+
+		clean := candidate
+		return &clean, nil
+	}
+
+	return nil, nil
+}
+
+func sameArtist(a, b *spotify.FullTrack) bool {
+	for _, x := range a.Artists {
+		for _, y := range b.Artists {
+			if x.ID == y.ID {
+				return true
+			}
+		}
+	}
+	return false
+}
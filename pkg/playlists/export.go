@@ -0,0 +1,292 @@
+package playlists
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	FormatM3U  string = "m3u"
+	FormatXSPF string = "xspf"
+	FormatJSPF string = "jspf"
+	FormatCSV  string = "csv"
+	FormatJSON string = "json"
+)
+
+var (
+	ErrExportFormatUnsupported = errors.New("unsupported export format")
+)
+
+var contentTypes = map[string]string{
+	FormatM3U:  "audio/x-mpegurl",
+	FormatXSPF: "application/xspf+xml",
+	FormatJSPF: "application/json",
+	FormatCSV:  "text/csv",
+	FormatJSON: "application/json",
+}
+
+func ContentType(format string) (string, error) {
+	contentType, ok := contentTypes[format]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrExportFormatUnsupported, format)
+	}
+	return contentType, nil
+}
+
+func ExportFilename(playlist *Playlist, format string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		case r == ' ':
+			return '-'
+		default:
+			return -1
+		}
+	}, playlist.Name)
+
+	return fmt.Sprintf("%s-%s.%s", name, playlist.ID, format)
+}
+
+func Export(w io.Writer, format string, playlist *Playlist, tracks []*Track) error {
+	switch format {
+	case FormatM3U:
+		return exportM3U(w, playlist, tracks)
+	case FormatXSPF:
+		return exportXSPF(w, playlist, tracks)
+	case FormatJSPF:
+		return exportJSPF(w, playlist, tracks)
+	case FormatCSV:
+		return exportCSV(w, tracks)
+	case FormatJSON:
+		return exportJSON(w, playlist, tracks)
+	default:
+		return fmt.Errorf("%w: %s", ErrExportFormatUnsupported, format)
+	}
+}
+
+// ExportArchive writes a zip archive holding one export per playlist
+func ExportArchive(w io.Writer, format string, playlists []*Playlist, tracks map[string][]*Track) error {
+	archive := zip.NewWriter(w)
+
+	for _, playlist := range playlists {
+		f, err := archive.CreateHeader(&zip.FileHeader{
+			Name:     ExportFilename(playlist, format),
+			Method:   zip.Deflate,
+			Modified: playlist.CreatedAt,
+		})
+		if err != nil {
+			return err
+		}
+
+		err = Export(f, format, playlist, tracks[playlist.ID])
+		if err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+func exportM3U(w io.Writer, playlist *Playlist, tracks []*Track) error {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n")
+	fmt.Fprintf(&b, "#PLAYLIST:%s\n", playlist.Name)
+
+	for _, track := range tracks {
+		fmt.Fprintf(&b, "#EXTINF:%d,%s - %s\n", int(track.Duration.Seconds()), track.Artists, track.Name)
+		fmt.Fprintf(&b, "#EXTALB:%s\n", track.Album)
+		if track.ISRC != "" {
+			fmt.Fprintf(&b, "#EXTISRC:%s\n", track.ISRC)
+		}
+		fmt.Fprintf(&b, "%s\n", track.URI)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+type xspfPlaylist struct {
+	XMLName    xml.Name    `xml:"playlist"`
+	Version    string      `xml:"version,attr"`
+	Namespace  string      `xml:"xmlns,attr"`
+	Title      string      `xml:"title"`
+	Annotation string      `xml:"annotation,omitempty"`
+	Location   string      `xml:"location,omitempty"`
+	Date       string      `xml:"date"`
+	Tracks     []xspfTrack `xml:"trackList>track"`
+}
+
+type xspfTrack struct {
+	Location    string   `xml:"location"`
+	Identifiers []string `xml:"identifier"`
+	Title       string   `xml:"title"`
+	Creator     string   `xml:"creator"`
+	Album       string   `xml:"album"`
+	Duration    int64    `xml:"duration"`
+}
+
+func exportXSPF(w io.Writer, playlist *Playlist, tracks []*Track) error {
+	doc := xspfPlaylist{
+		Version:    "1",
+		Namespace:  "http://xspf.org/ns/0/",
+		Title:      playlist.Name,
+		Annotation: playlist.Description,
+		Location:   playlist.SpotifyURL,
+		Date:       playlist.CreatedAt.Format(time.RFC3339),
+	}
+
+	for _, track := range tracks {
+		doc.Tracks = append(doc.Tracks, xspfTrack{
+			Location:    string(track.URI),
+			Identifiers: identifiers(track),
+			Title:       track.Name,
+			Creator:     track.Artists,
+			Album:       track.Album,
+			Duration:    track.Duration.Milliseconds(),
+		})
+	}
+
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	return encoder.Encode(doc)
+}
+
+type jspfDocument struct {
+	Playlist jspfPlaylist `json:"playlist"`
+}
+
+type jspfPlaylist struct {
+	Title      string      `json:"title"`
+	Annotation string      `json:"annotation,omitempty"`
+	Identifier string      `json:"identifier,omitempty"`
+	Date       string      `json:"date"`
+	Tracks     []jspfTrack `json:"track"`
+}
+
+type jspfTrack struct {
+	Title      string   `json:"title"`
+	Creator    string   `json:"creator"`
+	Album      string   `json:"album"`
+	Duration   int64    `json:"duration"`
+	Location   []string `json:"location"`
+	Identifier []string `json:"identifier"`
+}
+
+func exportJSPF(w io.Writer, playlist *Playlist, tracks []*Track) error {
+	doc := jspfDocument{
+		Playlist: jspfPlaylist{
+			Title:      playlist.Name,
+			Annotation: playlist.Description,
+			Identifier: playlist.SpotifyURL,
+			Date:       playlist.CreatedAt.Format(time.RFC3339),
+			Tracks:     []jspfTrack{},
+		},
+	}
+
+	for _, track := range tracks {
+		doc.Playlist.Tracks = append(doc.Playlist.Tracks, jspfTrack{
+			Title:      track.Name,
+			Creator:    track.Artists,
+			Album:      track.Album,
+			Duration:   track.Duration.Milliseconds(),
+			Location:   []string{string(track.URI)},
+			Identifier: identifiers(track),
+		})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(doc)
+}
+
+func exportCSV(w io.Writer, tracks []*Track) error {
+	writer := csv.NewWriter(w)
+
+	err := writer.Write([]string{"name", "artists", "album", "isrc", "duration_ms", "spotify_uri"})
+	if err != nil {
+		return err
+	}
+
+	for _, track := range tracks {
+		err := writer.Write([]string{
+			track.Name,
+			track.Artists,
+			track.Album,
+			track.ISRC,
+			strconv.FormatInt(track.Duration.Milliseconds(), 10),
+			string(track.URI),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+type jsonPlaylist struct {
+	ID          string      `json:"id"`
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	SpotifyURL  string      `json:"spotify_url,omitempty"`
+	CreatedAt   time.Time   `json:"created_at"`
+	Tracks      []jsonTrack `json:"tracks"`
+}
+
+type jsonTrack struct {
+	Name       string `json:"name"`
+	Artists    string `json:"artists"`
+	Album      string `json:"album"`
+	ISRC       string `json:"isrc,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+	URI        string `json:"spotify_uri"`
+}
+
+func exportJSON(w io.Writer, playlist *Playlist, tracks []*Track) error {
+	doc := jsonPlaylist{
+		ID:          playlist.ID,
+		Name:        playlist.Name,
+		Description: playlist.Description,
+		SpotifyURL:  playlist.SpotifyURL,
+		CreatedAt:   playlist.CreatedAt,
+		Tracks:      []jsonTrack{},
+	}
+
+	for _, track := range tracks {
+		doc.Tracks = append(doc.Tracks, jsonTrack{
+			Name:       track.Name,
+			Artists:    track.Artists,
+			Album:      track.Album,
+			ISRC:       track.ISRC,
+			DurationMs: track.Duration.Milliseconds(),
+			URI:        string(track.URI),
+		})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(doc)
+}
+
+func identifiers(track *Track) []string {
+	ids := []string{fmt.Sprintf("https://open.spotify.com/track/%s", track.ID)}
+	if track.ISRC != "" {
+		ids = append(ids, fmt.Sprintf("isrc:%s", track.ISRC))
+	}
+	return ids
+}
@@ -0,0 +1,271 @@
+package playlists
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestExport(t *testing.T) {
+	playlist := &Playlist{
+		ID:          "playlist-id",
+		Name:        "Spautofy: Apr 2021",
+		Description: "Your top tracks",
+		SpotifyURL:  "https://open.spotify.com/playlist/spotify-id",
+		CreatedAt:   time.Date(2021, time.April, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	tracks := []*Track{
+		{
+			ID:       "track1",
+			Name:     "Track 1",
+			Artists:  "Artist A, Artist B",
+			Album:    "Album",
+			ISRC:     "GBAAA2100001",
+			Duration: 3*time.Minute + 30*time.Second,
+			URI:      "spotify:track:track1",
+		},
+		{
+			ID:       "track2",
+			Name:     "Track 2",
+			Artists:  "Artist C",
+			Album:    "Album",
+			Duration: 2 * time.Minute,
+			URI:      "spotify:track:track2",
+		},
+	}
+
+	tests := []struct {
+		format string
+		output string
+	}{
+		{
+			format: FormatM3U,
+			output: `#EXTM3U
+#PLAYLIST:Spautofy: Apr 2021
+#EXTINF:210,Artist A, Artist B - Track 1
+#EXTALB:Album
+#EXTISRC:GBAAA2100001
+spotify:track:track1
+#EXTINF:120,Artist C - Track 2
+#EXTALB:Album
+spotify:track:track2
+`,
+		},
+		{
+			format: FormatXSPF,
+			output: `<?xml version="1.0" encoding="UTF-8"?>
+<playlist version="1" xmlns="http://xspf.org/ns/0/">
+  <title>Spautofy: Apr 2021</title>
+  <annotation>Your top tracks</annotation>
+  <location>https://open.spotify.com/playlist/spotify-id</location>
+  <date>2021-04-01T00:00:00Z</date>
+  <trackList>
+    <track>
+      <location>spotify:track:track1</location>
+      <identifier>https://open.spotify.com/track/track1</identifier>
+      <identifier>isrc:GBAAA2100001</identifier>
+      <title>Track 1</title>
+      <creator>Artist A, Artist B</creator>
+      <album>Album</album>
+      <duration>210000</duration>
+    </track>
+    <track>
+      <location>spotify:track:track2</location>
+      <identifier>https://open.spotify.com/track/track2</identifier>
+      <title>Track 2</title>
+      <creator>Artist C</creator>
+      <album>Album</album>
+      <duration>120000</duration>
+    </track>
+  </trackList>
+</playlist>`,
+		},
+		{
+			format: FormatJSPF,
+			output: `{
+  "playlist": {
+    "title": "Spautofy: Apr 2021",
+    "annotation": "Your top tracks",
+    "identifier": "https://open.spotify.com/playlist/spotify-id",
+    "date": "2021-04-01T00:00:00Z",
+    "track": [
+      {
+        "title": "Track 1",
+        "creator": "Artist A, Artist B",
+        "album": "Album",
+        "duration": 210000,
+        "location": [
+          "spotify:track:track1"
+        ],
+        "identifier": [
+          "https://open.spotify.com/track/track1",
+          "isrc:GBAAA2100001"
+        ]
+      },
+      {
+        "title": "Track 2",
+        "creator": "Artist C",
+        "album": "Album",
+        "duration": 120000,
+        "location": [
+          "spotify:track:track2"
+        ],
+        "identifier": [
+          "https://open.spotify.com/track/track2"
+        ]
+      }
+    ]
+  }
+}
+`,
+		},
+		{
+			format: FormatCSV,
+			output: `name,artists,album,isrc,duration_ms,spotify_uri
+Track 1,"Artist A, Artist B",Album,GBAAA2100001,210000,spotify:track:track1
+Track 2,Artist C,Album,,120000,spotify:track:track2
+`,
+		},
+		{
+			format: FormatJSON,
+			output: `{
+  "id": "playlist-id",
+  "name": "Spautofy: Apr 2021",
+  "description": "Your top tracks",
+  "spotify_url": "https://open.spotify.com/playlist/spotify-id",
+  "created_at": "2021-04-01T00:00:00Z",
+  "tracks": [
+    {
+      "name": "Track 1",
+      "artists": "Artist A, Artist B",
+      "album": "Album",
+      "isrc": "GBAAA2100001",
+      "duration_ms": 210000,
+      "spotify_uri": "spotify:track:track1"
+    },
+    {
+      "name": "Track 2",
+      "artists": "Artist C",
+      "album": "Album",
+      "duration_ms": 120000,
+      "spotify_uri": "spotify:track:track2"
+    }
+  ]
+}
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var b bytes.Buffer
+			err := Export(&b, tt.format, playlist, tracks)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if output := b.String(); output != tt.output {
+				t.Errorf("expected output:\n%s\ngot:\n%s", tt.output, output)
+			}
+		})
+	}
+}
+
+func TestExportEmptyPlaylist(t *testing.T) {
+	playlist := &Playlist{
+		ID:        "playlist-id",
+		Name:      "Empty",
+		CreatedAt: time.Date(2021, time.April, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	tests := []struct {
+		format string
+		output string
+	}{
+		{format: FormatM3U, output: "#EXTM3U\n#PLAYLIST:Empty\n"},
+		{format: FormatCSV, output: "name,artists,album,isrc,duration_ms,spotify_uri\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var b bytes.Buffer
+			err := Export(&b, tt.format, playlist, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if output := b.String(); output != tt.output {
+				t.Errorf("expected %q, got %q", tt.output, output)
+			}
+		})
+	}
+}
+
+func TestExportUnsupportedFormat(t *testing.T) {
+	var b bytes.Buffer
+	err := Export(&b, "pdf", &Playlist{}, nil)
+	if !errors.Is(err, ErrExportFormatUnsupported) {
+		t.Errorf("expected error %v, got %v", ErrExportFormatUnsupported, err)
+	}
+
+	_, err = ContentType("pdf")
+	if !errors.Is(err, ErrExportFormatUnsupported) {
+		t.Errorf("expected error %v, got %v", ErrExportFormatUnsupported, err)
+	}
+}
+
+func TestExportFilename(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		filename string
+	}{
+		{name: "Spautofy: Apr 2021", format: FormatM3U, filename: "Spautofy-Apr-2021-playlist-id.m3u"},
+		{name: "Road_Trip (Vol. 2)!", format: FormatCSV, filename: "Road_Trip-Vol-2-playlist-id.csv"},
+		{name: "Ça va", format: FormatJSON, filename: "a-va-playlist-id.json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			playlist := &Playlist{ID: "playlist-id", Name: tt.name}
+			if filename := ExportFilename(playlist, tt.format); filename != tt.filename {
+				t.Errorf("expected %q, got %q", tt.filename, filename)
+			}
+		})
+	}
+}
+
+func TestExportArchive(t *testing.T) {
+	playlists := []*Playlist{
+		{ID: "first", Name: "First", CreatedAt: time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)},
+		{ID: "second", Name: "Second", CreatedAt: time.Date(2021, time.April, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	tracks := map[string][]*Track{
+		"first": {{ID: "track1", Name: "Track 1", URI: "spotify:track:track1"}},
+	}
+
+	var b bytes.Buffer
+	err := ExportArchive(&b, FormatM3U, playlists, tracks)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	if err != nil {
+		t.Fatalf("failed to read archive: %v", err)
+	}
+
+	expected := []string{"First-first.m3u", "Second-second.m3u"}
+	if len(archive.File) != len(expected) {
+		t.Fatalf("expected %d files, got %d", len(expected), len(archive.File))
+	}
+	for idx, f := range archive.File {
+		if f.Name != expected[idx] {
+			t.Errorf("expected file %d to be %q, got %q", idx, expected[idx], f.Name)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package playlists
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zmb3/spotify"
+)
+
+const (
+	genreCacheTTL       = 24 * time.Hour
+	maxArtistsBatchSize = 50
+)
+
+type genreCache struct {
+	mu      sync.RWMutex
+	ttl     time.Duration
+	artists map[spotify.ID]*cachedGenres
+}
+
+type cachedGenres struct {
+	genres    []string
+	fetchedAt time.Time
+}
+
+func newGenreCache(ttl time.Duration) *genreCache {
+	return &genreCache{
+		ttl:     ttl,
+		artists: make(map[spotify.ID]*cachedGenres),
+	}
+}
+
+func (c *genreCache) get(artistID spotify.ID) ([]string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	cached, ok := c.artists[artistID]
+	if !ok || time.Since(cached.fetchedAt) > c.ttl {
+		return nil, false
+	}
+
+	return cached.genres, true
+}
+
+func (c *genreCache) set(artistID spotify.ID, genres []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.artists[artistID] = &cachedGenres{
+		genres:    genres,
+		fetchedAt: time.Now(),
+	}
+}
+
+func (b *Builder) artistGenres(artistIDs []spotify.ID) (map[spotify.ID][]string, error) {
+	genres := make(map[spotify.ID][]string, len(artistIDs))
+
+	var missing []spotify.ID
+	for _, id := range artistIDs {
+		if _, ok := genres[id]; ok {
+			continue
+		}
+
+		cached, ok := b.genres.get(id)
+		if ok {
+			genres[id] = cached
+			continue
+		}
+
+		genres[id] = nil
+		missing = append(missing, id)
+	}
+
+	for start := 0; start < len(missing); start += maxArtistsBatchSize {
+		end := start + maxArtistsBatchSize
+		if end > len(missing) {
+			end = len(missing)
+		}
+
+		artists, err := b.client.GetArtists(missing[start:end]...)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, artist := range artists {
+			if artist == nil {
+				continue
+			}
+
+			genres[artist.ID] = artist.Genres
+			b.genres.set(artist.ID, artist.Genres)
+		}
+	}
+
+	return genres, nil
+}
+
+// genreFilter keeps the tracks by artists with a genre in include, if any, and none in exclude
+func (b *Builder) genreFilter(include, exclude []string) TrackFilter {
+	return func(trackIDs []spotify.ID) ([]spotify.ID, error) {
+		tracks, err := fetchFullTracks(b.client, trackIDs)
+		if err != nil {
+			return nil, err
+		}
+
+		var artistIDs []spotify.ID
+		for _, track := range tracks {
+			for _, artist := range track.Artists {
+				artistIDs = append(artistIDs, artist.ID)
+			}
+		}
+
+		genres, err := b.artistGenres(artistIDs)
+		if err != nil {
+			return nil, err
+		}
+
+		var accepted []spotify.ID
+		for _, track := range tracks {
+			var trackGenres []string
+			for _, artist := range track.Artists {
+				trackGenres = append(trackGenres, genres[artist.ID]...)
+			}
+
+			if matchGenres(trackGenres, exclude) {
+				continue
+			}
+
+			if len(include) > 0 && !matchGenres(trackGenres, include) {
+				continue
+			}
+
+			accepted = append(accepted, track.ID)
+		}
+
+		return accepted, nil
+	}
+}
+
+func matchGenres(genres, terms []string) bool {
+	for _, genre := range genres {
+		for _, term := range terms {
+			if strings.Contains(strings.ToLower(genre), term) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func ParseGenres(text string) []string {
+	genres := []string{}
+	for _, genre := range strings.Split(text, ",") {
+		genre = strings.ToLower(strings.TrimSpace(genre))
+		if genre != "" {
+			genres = append(genres, genre)
+		}
+	}
+	return genres
+}
@@ -0,0 +1,173 @@
+package playlists
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/zmb3/spotify"
+
+	"github.com/jace-ys/spautofy/pkg/accounts"
+	"github.com/jace-ys/spautofy/pkg/groups"
+)
+
+// BlendGroup interleaves the members' top tracks in rounds, so every member gets the same number of picks. Within
+// a member's turn, tracks shared with other members score higher and are picked first.
+func BlendGroup(memberTracks [][]spotify.ID, limit int) []spotify.ID {
+	scores := make(map[spotify.ID]float64)
+	for _, trackIDs := range memberTracks {
+		for idx, id := range trackIDs {
+			scores[id] += float64(len(trackIDs)-idx) / float64(len(trackIDs))
+		}
+	}
+
+	queues := make([][]spotify.ID, len(memberTracks))
+	for idx, trackIDs := range memberTracks {
+		queue := make([]spotify.ID, len(trackIDs))
+		copy(queue, trackIDs)
+		sort.SliceStable(queue, func(i, j int) bool {
+			return scores[queue[i]] > scores[queue[j]]
+		})
+		queues[idx] = queue
+	}
+
+	picked := make(map[spotify.ID]bool)
+	var blended []spotify.ID
+	for round := 0; len(blended) < limit; round++ {
+		var added bool
+		for offset := range queues {
+			if len(blended) == limit {
+				break
+			}
+
+			// rotate who picks first, so the first member does not always get the highest slot
+			member := (round + offset) % len(queues)
+			for len(queues[member]) > 0 {
+				id := queues[member][0]
+				queues[member] = queues[member][1:]
+				if !picked[id] {
+					picked[id] = true
+					blended = append(blended, id)
+					added = true
+					break
+				}
+			}
+		}
+
+		if !added {
+			break
+		}
+	}
+
+	return blended
+}
+
+func GroupPlaylistName(group *groups.Group, now time.Time) string {
+	return fmt.Sprintf("%s: %s", group.Name, now.Format("Jan 2006"))
+}
+
+// RunGroup builds the next playlist for group on its owner's account, returning the ID of the playlist it produced
+func (bf *BuilderFactory) RunGroup(ctx context.Context, logger log.Logger, registry *groups.Registry, group *groups.Group) (string, error) {
+	logger.Log("event", "group.build.started", "group", group.ID)
+
+	members, err := registry.ListMembers(ctx, group.ID)
+	if err != nil {
+		logger.Log("event", "members.list.failed", "error", err)
+		return "", fmt.Errorf("failed to list members: %w", err)
+	}
+
+	var owner *Builder
+	var builders []*Builder
+	var memberTracks [][]spotify.ID
+	for _, member := range members {
+		builder, err := bf.NewBuilder(ctx, logger, member.UserID)
+		if err != nil {
+			// skip as the user might have revoked access to their account
+			logger.Log("event", "group.member.skipped", "group", group.ID, "user", member.UserID)
+			continue
+		}
+
+		source := &topTracksSource{client: builder.client}
+		trackIDs, err := source.Tracks(group.TrackLimit, TimerangeShort, nil)
+		if err != nil {
+			logger.Log("event", "group.member.skipped", "group", group.ID, "user", member.UserID, "error", err)
+			continue
+		}
+
+		builders = append(builders, builder)
+		memberTracks = append(memberTracks, trackIDs)
+		if member.UserID == group.OwnerID {
+			owner = builder
+		}
+	}
+
+	if owner == nil {
+		logger.Log("event", "group.build.failed", "group", group.ID, "error", "owner unavailable")
+		return "", errors.New("failed to access owner's spotify account")
+	}
+
+	// members can only open the playlist when it is public, so it is not worth building a private one
+	if err := owner.requireVisibility(VisibilityPublic); err != nil {
+		logger.Log("event", "group.build.failed", "group", group.ID, "error", err)
+		return "", err
+	}
+
+	playlist := &Playlist{
+		UserID:      group.OwnerID,
+		Kind:        KindGroup,
+		Name:        GroupPlaylistName(group, time.Now()),
+		Description: fmt.Sprintf("A blend of top tracks from %d members of %s", len(builders), group.Name),
+		TrackIDs:    BlendGroup(memberTracks, group.TrackLimit),
+		BuildStep:   BuildStepPending,
+	}
+
+	// the owner's own settings do not apply to the group playlist
+	account := &accounts.Account{
+		UserID:     group.OwnerID,
+		Schedule:   group.Schedule,
+		Visibility: VisibilityPublic,
+		WithCover:  true,
+	}
+
+	_, err = owner.prepareNew(ctx, account, playlist)
+	if err != nil {
+		logger.Log("event", "playlist.create.failed", "error", err)
+		return "", fmt.Errorf("failed to create playlist: %w", err)
+	}
+
+	if err := owner.cacheTracks(ctx, playlist.TrackIDs); err != nil {
+		logger.Log("event", "tracks.cache.failed", "error", err)
+	}
+
+	err = owner.Build(ctx, account, playlist)
+	if err != nil {
+		logger.Log("event", "group.build.failed", "group", group.ID, "error", err)
+		return playlist.ID, fmt.Errorf("failed to build playlist: %w", err)
+	}
+
+	logger.Log("event", "group.build.finished", "group", group.ID, "id", playlist.ID)
+
+	// every member is emailed even when some fail, so only the first failure is reported
+	var mailErr error
+	for _, builder := range builders {
+		accountURL := *bf.baseURL
+		accountURL.Path = path.Join(accountURL.Path, "accounts", builder.user.ID, "groups")
+
+		err = bf.mailer.SendNewPlaylistEmail(builder.user, false, playlist.SpotifyURL, accountURL.String())
+		if err != nil {
+			logger.Log("event", "email.send.failed", "error", err)
+			if mailErr == nil {
+				mailErr = fmt.Errorf("failed to send email: %w", err)
+			}
+			continue
+		}
+
+		logger.Log("event", "email.sent", "email", builder.user.Email)
+	}
+
+	return playlist.ID, mailErr
+}
@@ -0,0 +1,51 @@
+package playlists
+
+import (
+	"testing"
+
+	"github.com/zmb3/spotify"
+)
+
+func TestBlendGroup(t *testing.T) {
+	tests := []struct {
+		name         string
+		memberTracks [][]spotify.ID
+		limit        int
+		blended      []spotify.ID
+	}{
+		{
+			name:  "no members",
+			limit: 10,
+		},
+		{
+			name:         "no limit",
+			memberTracks: [][]spotify.ID{{"a1", "a2"}, {"b1", "b2"}},
+		},
+		{
+			name:         "members take turns and rotate who picks first",
+			memberTracks: [][]spotify.ID{{"a1", "a2", "a3"}, {"b1", "b2", "b3"}},
+			limit:        4,
+			blended:      []spotify.ID{"a1", "b1", "b2", "a2"},
+		},
+		{
+			name:         "shared tracks are picked first and only once",
+			memberTracks: [][]spotify.ID{{"a1", "s", "a2"}, {"s", "b1", "b2"}},
+			limit:        4,
+			blended:      []spotify.ID{"s", "b1", "b2", "a1"},
+		},
+		{
+			name:         "fewer tracks than the limit",
+			memberTracks: [][]spotify.ID{{"a1"}, {"b1", "b2"}},
+			limit:        10,
+			blended:      []spotify.ID{"a1", "b1", "b2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if blended := BlendGroup(tt.memberTracks, tt.limit); !equalIDs(blended, tt.blended) {
+				t.Errorf("expected %v, got %v", tt.blended, blended)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package playlists
+
+import (
+	"sort"
+
+	"github.com/zmb3/spotify"
+)
+
+const (
+	OrderingRank     string = "rank"
+	OrderingEnergy   string = "energy"
+	OrderingTempo    string = "tempo"
+	OrderingHarmonic string = "harmonic"
+)
+
+const (
+	maxAudioFeaturesBatchSize = 100
+)
+
+func (b *Builder) order(trackIDs []spotify.ID, ordering string) ([]spotify.ID, error) {
+	switch ordering {
+	case OrderingEnergy, OrderingTempo, OrderingHarmonic:
+		// no-op
+	default:
+		return trackIDs, nil
+	}
+
+	features, err := b.audioFeatures(trackIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	ordered := make([]spotify.ID, len(trackIDs))
+	copy(ordered, trackIDs)
+
+	switch ordering {
+	case OrderingEnergy:
+		sort.SliceStable(ordered, func(i, j int) bool {
+			return features[ordered[i]].Energy < features[ordered[j]].Energy
+		})
+	case OrderingTempo:
+		ordered = tempoCurve(ordered, features)
+	case OrderingHarmonic:
+		ordered = harmonicMix(ordered, features)
+	}
+
+	return ordered, nil
+}
+
+func (b *Builder) audioFeatures(trackIDs []spotify.ID) (map[spotify.ID]*spotify.AudioFeatures, error) {
+	features := make(map[spotify.ID]*spotify.AudioFeatures, len(trackIDs))
+	for start := 0; start < len(trackIDs); start += maxAudioFeaturesBatchSize {
+		end := start + maxAudioFeaturesBatchSize
+		if end > len(trackIDs) {
+			end = len(trackIDs)
+		}
+
+		batch, err := b.client.GetAudioFeatures(trackIDs[start:end]...)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range batch {
+			if f != nil {
+				features[f.ID] = f
+			}
+		}
+	}
+
+	// tracks without audio features are treated as having neutral values
+	for _, id := range trackIDs {
+		if _, ok := features[id]; !ok {
+			features[id] = &spotify.AudioFeatures{ID: id, Key: -1}
+		}
+	}
+
+	return features, nil
+}
+
+func tempoCurve(trackIDs []spotify.ID, features map[spotify.ID]*spotify.AudioFeatures) []spotify.ID {
+	sorted := make([]spotify.ID, len(trackIDs))
+	copy(sorted, trackIDs)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return features[sorted[i]].Tempo < features[sorted[j]].Tempo
+	})
+
+	// build up to the fastest tracks in the middle of the playlist before winding back down
+	ordered := make([]spotify.ID, len(sorted))
+	front, back := 0, len(sorted)-1
+	for idx, id := range sorted {
+		if idx%2 == 0 {
+			ordered[front] = id
+			front++
+		} else {
+			ordered[back] = id
+			back--
+		}
+	}
+
+	return ordered
+}
+
+func harmonicMix(trackIDs []spotify.ID, features map[spotify.ID]*spotify.AudioFeatures) []spotify.ID {
+	if len(trackIDs) == 0 {
+		return trackIDs
+	}
+
+	used := make([]bool, len(trackIDs))
+	ordered := make([]spotify.ID, 0, len(trackIDs))
+
+	// start from the top ranked track and greedily follow the closest key on the Camelot wheel
+	current := 0
+	for {
+		used[current] = true
+		ordered = append(ordered, trackIDs[current])
+
+		next, best := -1, 0
+		for idx, id := range trackIDs {
+			if used[idx] {
+				continue
+			}
+
+			distance := camelotDistance(features[trackIDs[current]], features[id])
+			if next == -1 || distance < best {
+				next, best = idx, distance
+			}
+		}
+
+		if next == -1 {
+			break
+		}
+		current = next
+	}
+
+	return ordered
+}
+
+func camelot(f *spotify.AudioFeatures) (int, bool) {
+	key := f.Key
+	minor := f.Mode == 0
+	if minor {
+		// minor keys share a number with their relative major
+		key = (key + 3) % 12
+	}
+
+	// each step around the wheel is a perfect fifth, with C major at 8B
+	return (key*7+7)%12 + 1, minor
+}
+
+func camelotDistance(a, b *spotify.AudioFeatures) int {
+	if a.Key < 0 || b.Key < 0 {
+		return 12
+	}
+
+	numberA, minorA := camelot(a)
+	numberB, minorB := camelot(b)
+
+	distance := numberA - numberB
+	if distance < 0 {
+		distance = -distance
+	}
+	if distance > 6 {
+		distance = 12 - distance
+	}
+
+	if minorA != minorB {
+		distance++
+	}
+
+	return distance
+}
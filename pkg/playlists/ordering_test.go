@@ -0,0 +1,156 @@
+package playlists
+
+import (
+	"testing"
+
+	"github.com/zmb3/spotify"
+)
+
+func TestCamelot(t *testing.T) {
+	tests := []struct {
+		name   string
+		key    int
+		mode   int
+		number int
+		minor  bool
+	}{
+		{name: "C major", key: 0, mode: 1, number: 8},
+		{name: "A minor", key: 9, mode: 0, number: 8, minor: true},
+		{name: "G major", key: 7, mode: 1, number: 9},
+		{name: "E minor", key: 4, mode: 0, number: 9, minor: true},
+		{name: "F major", key: 5, mode: 1, number: 7},
+		{name: "F sharp major", key: 6, mode: 1, number: 2},
+		{name: "B major", key: 11, mode: 1, number: 1},
+		{name: "E major", key: 4, mode: 1, number: 12},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			number, minor := camelot(&spotify.AudioFeatures{Key: tt.key, Mode: tt.mode})
+			if number != tt.number || minor != tt.minor {
+				t.Errorf("expected (%d, %t), got (%d, %t)", tt.number, tt.minor, number, minor)
+			}
+		})
+	}
+}
+
+func TestCamelotDistance(t *testing.T) {
+	var (
+		cMajor      = &spotify.AudioFeatures{Key: 0, Mode: 1}
+		aMinor      = &spotify.AudioFeatures{Key: 9, Mode: 0}
+		gMajor      = &spotify.AudioFeatures{Key: 7, Mode: 1}
+		dMajor      = &spotify.AudioFeatures{Key: 2, Mode: 1}
+		fSharpMajor = &spotify.AudioFeatures{Key: 6, Mode: 1}
+		bMajor      = &spotify.AudioFeatures{Key: 11, Mode: 1}
+		eMajor      = &spotify.AudioFeatures{Key: 4, Mode: 1}
+		unknown     = &spotify.AudioFeatures{Key: -1}
+	)
+
+	tests := []struct {
+		name     string
+		a, b     *spotify.AudioFeatures
+		distance int
+	}{
+		{name: "same key", a: cMajor, b: cMajor, distance: 0},
+		{name: "relative minor", a: cMajor, b: aMinor, distance: 1},
+		{name: "next on the wheel", a: cMajor, b: gMajor, distance: 1},
+		{name: "two steps", a: cMajor, b: dMajor, distance: 2},
+		{name: "opposite side of the wheel", a: cMajor, b: fSharpMajor, distance: 6},
+		{name: "across 12 and 1", a: bMajor, b: eMajor, distance: 1},
+		{name: "step and mode change", a: aMinor, b: gMajor, distance: 2},
+		{name: "unknown key", a: cMajor, b: unknown, distance: 12},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if distance := camelotDistance(tt.a, tt.b); distance != tt.distance {
+				t.Errorf("expected %d, got %d", tt.distance, distance)
+			}
+			if distance := camelotDistance(tt.b, tt.a); distance != tt.distance {
+				t.Errorf("expected %d in reverse, got %d", tt.distance, distance)
+			}
+		})
+	}
+}
+
+func TestHarmonicMix(t *testing.T) {
+	features := map[spotify.ID]*spotify.AudioFeatures{
+		"c":       {Key: 0, Mode: 1},
+		"f-sharp": {Key: 6, Mode: 1},
+		"g":       {Key: 7, Mode: 1},
+		"d":       {Key: 2, Mode: 1},
+		"a-minor": {Key: 9, Mode: 0},
+		"unknown": {Key: -1},
+	}
+
+	tests := []struct {
+		name     string
+		trackIDs []spotify.ID
+		ordered  []spotify.ID
+	}{
+		{
+			name: "no tracks",
+		},
+		{
+			name:     "follows the closest key from the top track",
+			trackIDs: []spotify.ID{"c", "f-sharp", "g", "d"},
+			ordered:  []spotify.ID{"c", "g", "d", "f-sharp"},
+		},
+		{
+			name:     "ties keep the ranked order",
+			trackIDs: []spotify.ID{"c", "a-minor", "g"},
+			ordered:  []spotify.ID{"c", "a-minor", "g"},
+		},
+		{
+			name:     "unknown keys go last",
+			trackIDs: []spotify.ID{"unknown", "c", "g"},
+			ordered:  []spotify.ID{"unknown", "c", "g"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if ordered := harmonicMix(tt.trackIDs, features); !equalIDs(ordered, tt.ordered) {
+				t.Errorf("expected %v, got %v", tt.ordered, ordered)
+			}
+		})
+	}
+}
+
+func TestTempoCurve(t *testing.T) {
+	features := map[spotify.ID]*spotify.AudioFeatures{
+		"a": {Tempo: 100},
+		"b": {Tempo: 120},
+		"c": {Tempo: 90},
+		"d": {Tempo: 140},
+		"e": {Tempo: 110},
+	}
+
+	tests := []struct {
+		name     string
+		trackIDs []spotify.ID
+		ordered  []spotify.ID
+	}{
+		{
+			name: "no tracks",
+		},
+		{
+			name:     "fastest in the middle",
+			trackIDs: []spotify.ID{"a", "b", "c", "d", "e"},
+			ordered:  []spotify.ID{"c", "e", "d", "b", "a"},
+		},
+		{
+			name:     "even number of tracks",
+			trackIDs: []spotify.ID{"a", "b", "c", "d"},
+			ordered:  []spotify.ID{"c", "b", "d", "a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if ordered := tempoCurve(tt.trackIDs, features); !equalIDs(ordered, tt.ordered) {
+				t.Errorf("expected %v, got %v", tt.ordered, ordered)
+			}
+		})
+	}
+}
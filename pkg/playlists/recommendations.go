@@ -0,0 +1,93 @@
+package playlists
+
+import (
+	"github.com/zmb3/spotify"
+)
+
+const (
+	maxRecommendationSeeds = 5
+	maxRecommendations     = 100
+	artistSeeds            = 2
+)
+
+func (b *Builder) recommend(topIDs []spotify.ID, timerange string, count int, exclude map[spotify.ID]bool) ([]spotify.ID, error) {
+	if count <= 0 {
+		return nil, nil
+	}
+
+	limit := artistSeeds
+	opts := &spotify.Options{
+		Limit:     &limit,
+		Timerange: &timerange,
+	}
+
+	artists, err := b.client.CurrentUsersTopArtistsOpt(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var seeds spotify.Seeds
+	for _, artist := range artists.Artists {
+		seeds.Artists = append(seeds.Artists, artist.ID)
+	}
+
+	for _, id := range topIDs {
+		if len(seeds.Artists)+len(seeds.Tracks) >= maxRecommendationSeeds {
+			break
+		}
+		seeds.Tracks = append(seeds.Tracks, id)
+	}
+
+	if len(seeds.Artists)+len(seeds.Tracks) == 0 {
+		return nil, nil
+	}
+
+	// request extra recommendations to make up for any that have been excluded
+	limit = count + len(exclude)
+	if limit > maxRecommendations {
+		limit = maxRecommendations
+	}
+
+	recommendations, err := b.client.GetRecommendations(seeds, nil, &spotify.Options{Limit: &limit})
+	if err != nil {
+		return nil, err
+	}
+
+	var recommendedIDs []spotify.ID
+	for _, track := range recommendations.Tracks {
+		if len(recommendedIDs) == count {
+			break
+		}
+
+		if exclude[track.ID] {
+			continue
+		}
+		exclude[track.ID] = true
+
+		recommendedIDs = append(recommendedIDs, track.ID)
+	}
+
+	return recommendedIDs, nil
+}
+
+func blend(topIDs, recommendedIDs []spotify.ID) []spotify.ID {
+	total := len(topIDs) + len(recommendedIDs)
+	trackIDs := make([]spotify.ID, 0, total)
+
+	// spread recommendations evenly throughout the top tracks
+	var top, recommended int
+	for idx := 0; idx < total; idx++ {
+		if recommended < len(recommendedIDs) && (recommended+1)*total <= (idx+1)*len(recommendedIDs) {
+			trackIDs = append(trackIDs, recommendedIDs[recommended])
+			recommended++
+		} else if top < len(topIDs) {
+			trackIDs = append(trackIDs, topIDs[top])
+			top++
+		} else {
+			trackIDs = append(trackIDs, recommendedIDs[recommended])
+			recommended++
+		}
+	}
+
+	return trackIDs
+}
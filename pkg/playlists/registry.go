@@ -12,25 +12,90 @@ import (
 	"github.com/zmb3/spotify"
 )
 
+const (
+	StatusDraft  string = "draft"
+	StatusBuilt  string = "built"
+	StatusFailed string = "failed"
+)
+
+// group and Year in Review playlists are saved under a user's account, but are not built from their own settings
+const (
+	KindPersonal string = "personal"
+	KindGroup    string = "group"
+	KindWrapped  string = "wrapped"
+)
+
 var (
 	ErrPlaylistNotFound = errors.New("playlist not found")
 	ErrPlaylistExists   = errors.New("playlist already exists")
+	ErrVersionNotFound  = errors.New("playlist version not found")
 )
 
 type Playlist struct {
-	ID          spotify.ID
-	UserID      string
-	Name        string
-	Description string
-	TrackIDs    []spotify.ID
-	SpotifyURL  string
-	SnapshotID  string
-	CreatedAt   time.Time
+	ID             string
+	SpotifyID      spotify.ID
+	UserID         string
+	Kind           string
+	Name           string
+	Description    string
+	TrackIDs       []spotify.ID
+	RecommendedIDs []spotify.ID
+	SpotifyURL     string
+	SnapshotID     string
+	BuildStep      string
+	BuildFailed    bool
+	BuiltAt        *time.Time
+	CreatedAt      time.Time
+}
+
+func (p *Playlist) Status() string {
+	switch {
+	case p.BuildStep == BuildStepFinished:
+		return StatusBuilt
+	case p.BuildFailed:
+		return StatusFailed
+	default:
+		return StatusDraft
+	}
+}
+
+func (p *Playlist) IsRecommended(trackID spotify.ID) bool {
+	for _, id := range p.RecommendedIDs {
+		if id == trackID {
+			return true
+		}
+	}
+	return false
 }
 
 type PlaylistEnvelope struct {
 	*Playlist
-	Tracks pq.StringArray
+	Tracks      pq.StringArray
+	Recommended pq.StringArray
+}
+
+func newPlaylistEnvelope(playlist *Playlist) *PlaylistEnvelope {
+	return &PlaylistEnvelope{
+		Playlist:    playlist,
+		Tracks:      toStringArray(playlist.TrackIDs),
+		Recommended: toStringArray(playlist.RecommendedIDs),
+	}
+}
+
+func toStringArray(ids []spotify.ID) pq.StringArray {
+	array := make(pq.StringArray, len(ids))
+	for idx, id := range ids {
+		array[idx] = string(id)
+	}
+	return array
+}
+
+func toIDs(array pq.StringArray) []spotify.ID {
+	ids := make([]spotify.ID, len(array))
+	for idx, id := range array {
+		ids[idx] = spotify.ID(id)
+	}
+	return ids
 }
 
 type Registry struct {
@@ -43,13 +108,44 @@ func NewRegistry(postgres *postgres.Client) *Registry {
 	}
 }
 
-func (r *Registry) Get(ctx context.Context, userID, name string) (*Playlist, error) {
+func (r *Registry) Get(ctx context.Context, userID, id string) (*Playlist, error) {
 	var envelope PlaylistEnvelope
 	err := r.database.Transact(ctx, func(tx *sqlx.Tx) error {
 		query := `
-		SELECT id, user_id, name, description, tracks, spotify_url, snapshot_id, created_at
+		SELECT id, spotify_id, user_id, kind, name, description, tracks, recommended, spotify_url, snapshot_id, build_step, build_failed, built_at, created_at
+		FROM playlists
+		WHERE user_id = $1 AND id = $2
+		`
+		row := tx.QueryRowxContext(ctx, query, userID, id)
+		return row.StructScan(&envelope)
+	})
+	if err != nil {
+		var pqErr *pq.Error
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrPlaylistNotFound
+		case errors.As(err, &pqErr) && pqErr.Code.Name() == "invalid_text_representation":
+			return nil, ErrPlaylistNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	envelope.Playlist.TrackIDs = toIDs(envelope.Tracks)
+	envelope.Playlist.RecommendedIDs = toIDs(envelope.Recommended)
+
+	return envelope.Playlist, nil
+}
+
+func (r *Registry) GetLatest(ctx context.Context, userID, name string) (*Playlist, error) {
+	var envelope PlaylistEnvelope
+	err := r.database.Transact(ctx, func(tx *sqlx.Tx) error {
+		query := `
+		SELECT id, spotify_id, user_id, kind, name, description, tracks, recommended, spotify_url, snapshot_id, build_step, build_failed, built_at, created_at
 		FROM playlists
 		WHERE user_id = $1 AND name = $2
+		ORDER BY created_at DESC
+		LIMIT 1
 		`
 		row := tx.QueryRowxContext(ctx, query, userID, name)
 		return row.StructScan(&envelope)
@@ -63,28 +159,119 @@ func (r *Registry) Get(ctx context.Context, userID, name string) (*Playlist, err
 		}
 	}
 
-	envelope.Playlist.TrackIDs = make([]spotify.ID, len(envelope.Tracks))
-	for idx, track := range envelope.Tracks {
-		envelope.Playlist.TrackIDs[idx] = spotify.ID(track)
-	}
+	envelope.Playlist.TrackIDs = toIDs(envelope.Tracks)
+	envelope.Playlist.RecommendedIDs = toIDs(envelope.Recommended)
 
 	return envelope.Playlist, nil
 }
 
-func (r *Registry) Create(ctx context.Context, playlist *Playlist) (spotify.ID, error) {
-	envelope := &PlaylistEnvelope{
-		Playlist: playlist,
-		Tracks:   make(pq.StringArray, len(playlist.TrackIDs)),
+// List returns the user's playlists, newest first. Group playlists are saved under their owner's account but belong
+// to the whole group, so they are left out here and in the other listings.
+func (r *Registry) List(ctx context.Context, userID string, limit, offset int) ([]*Playlist, error) {
+	var playlists []*Playlist
+	err := r.database.Transact(ctx, func(tx *sqlx.Tx) error {
+		query := `
+		SELECT id, spotify_id, user_id, kind, name, description, tracks, recommended, spotify_url, snapshot_id, build_step, build_failed, built_at, created_at
+		FROM playlists
+		WHERE user_id = $1 AND kind <> 'group'
+		ORDER BY created_at DESC
+		LIMIT $2 OFFSET $3
+		`
+		rows, err := tx.QueryxContext(ctx, query, userID, limit, offset)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var envelope PlaylistEnvelope
+			if err := rows.StructScan(&envelope); err != nil {
+				return err
+			}
+			envelope.Playlist.TrackIDs = toIDs(envelope.Tracks)
+			envelope.Playlist.RecommendedIDs = toIDs(envelope.Recommended)
+			playlists = append(playlists, envelope.Playlist)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return playlists, nil
+}
+
+func (r *Registry) ListRecent(ctx context.Context, userID string, limit int) ([]*Playlist, error) {
+	var playlists []*Playlist
+	err := r.database.Transact(ctx, func(tx *sqlx.Tx) error {
+		query := `
+		SELECT id, spotify_id, user_id, kind, name, description, tracks, recommended, spotify_url, snapshot_id, build_step, build_failed, built_at, created_at
+		FROM playlists
+		WHERE user_id = $1 AND kind <> 'group'
+		ORDER BY created_at DESC
+		LIMIT $2
+		`
+		rows, err := tx.QueryxContext(ctx, query, userID, limit)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var envelope PlaylistEnvelope
+			if err := rows.StructScan(&envelope); err != nil {
+				return err
+			}
+			envelope.Playlist.TrackIDs = toIDs(envelope.Tracks)
+			envelope.Playlist.RecommendedIDs = toIDs(envelope.Recommended)
+			playlists = append(playlists, envelope.Playlist)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	for idx, track := range playlist.TrackIDs {
-		envelope.Tracks[idx] = string(track)
+	return playlists, nil
+}
+
+func (r *Registry) ListBetween(ctx context.Context, userID string, from, to time.Time) ([]*Playlist, error) {
+	var playlists []*Playlist
+	err := r.database.Transact(ctx, func(tx *sqlx.Tx) error {
+		query := `
+		SELECT id, spotify_id, user_id, kind, name, description, tracks, recommended, spotify_url, snapshot_id, build_step, build_failed, built_at, created_at
+		FROM playlists
+		WHERE user_id = $1 AND kind <> 'group' AND COALESCE(built_at, created_at) >= $2 AND COALESCE(built_at, created_at) < $3
+		ORDER BY COALESCE(built_at, created_at) ASC
+		`
+		rows, err := tx.QueryxContext(ctx, query, userID, from, to)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var envelope PlaylistEnvelope
+			if err := rows.StructScan(&envelope); err != nil {
+				return err
+			}
+			envelope.Playlist.TrackIDs = toIDs(envelope.Tracks)
+			envelope.Playlist.RecommendedIDs = toIDs(envelope.Recommended)
+			playlists = append(playlists, envelope.Playlist)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
 	}
 
+	return playlists, nil
+}
+
+func (r *Registry) Create(ctx context.Context, playlist *Playlist) (string, error) {
+	envelope := newPlaylistEnvelope(playlist)
+
 	err := r.database.Transact(ctx, func(tx *sqlx.Tx) error {
 		query := `
-		INSERT INTO playlists (id, user_id, name, description, tracks, spotify_url, snapshot_id)
-		VALUES (:id, :user_id, :name, :description, :tracks, :spotify_url, :snapshot_id)
+		INSERT INTO playlists (spotify_id, user_id, kind, name, description, tracks, recommended, spotify_url, snapshot_id, build_step, build_failed)
+		VALUES (:spotify_id, :user_id, :kind, :name, :description, :tracks, :recommended, :spotify_url, :snapshot_id, :build_step, :build_failed)
 		RETURNING id
 		`
 		stmt, err := tx.PrepareNamedContext(ctx, query)
@@ -107,25 +294,23 @@ func (r *Registry) Create(ctx context.Context, playlist *Playlist) (spotify.ID,
 	return playlist.ID, nil
 }
 
-func (r *Registry) Update(ctx context.Context, playlist *Playlist) (spotify.ID, error) {
-	envelope := &PlaylistEnvelope{
-		Playlist: playlist,
-		Tracks:   make(pq.StringArray, len(playlist.TrackIDs)),
-	}
-
-	for idx, track := range playlist.TrackIDs {
-		envelope.Tracks[idx] = string(track)
-	}
+func (r *Registry) Update(ctx context.Context, playlist *Playlist) (string, error) {
+	envelope := newPlaylistEnvelope(playlist)
 
 	err := r.database.Transact(ctx, func(tx *sqlx.Tx) error {
 		query := `
 		UPDATE playlists SET
-			id = :id,
+			spotify_id = :spotify_id,
+			name = :name,
 			description = :description,
 			tracks = :tracks,
+			recommended = :recommended,
 			spotify_url = :spotify_url,
-			snapshot_id = :snapshot_id
-		WHERE user_id = :user_id AND name = :name
+			snapshot_id = :snapshot_id,
+			build_step = :build_step,
+			build_failed = :build_failed,
+			built_at = :built_at
+		WHERE user_id = :user_id AND id = :id
 		RETURNING id
 		`
 		stmt, err := tx.PrepareNamedContext(ctx, query)
@@ -147,16 +332,16 @@ func (r *Registry) Update(ctx context.Context, playlist *Playlist) (spotify.ID,
 	return playlist.ID, nil
 }
 
-func (r *Registry) Delete(ctx context.Context, userID, name string) error {
-	var id string
+func (r *Registry) Delete(ctx context.Context, userID, id string) error {
+	var deleted string
 	err := r.database.Transact(ctx, func(tx *sqlx.Tx) error {
 		query := `
 		DELETE FROM playlists
-		WHERE user_id = $1 AND name = $2
+		WHERE user_id = $1 AND id = $2
 		RETURNING id
 		`
-		row := tx.QueryRowContext(ctx, query, userID, name)
-		return row.Scan(&id)
+		row := tx.QueryRowContext(ctx, query, userID, id)
+		return row.Scan(&deleted)
 	})
 	if err != nil {
 		switch {
@@ -169,3 +354,144 @@ func (r *Registry) Delete(ctx context.Context, userID, name string) error {
 
 	return nil
 }
+
+type Version struct {
+	ID         string
+	UserID     string
+	Name       string
+	PlaylistID string
+	TrackIDs   []spotify.ID
+	SnapshotID string
+	BuiltAt    *time.Time
+	CreatedAt  time.Time
+}
+
+type VersionEnvelope struct {
+	*Version
+	Tracks pq.StringArray
+}
+
+func (r *Registry) ListVersions(ctx context.Context, userID, playlistID string) ([]*Version, error) {
+	var versions []*Version
+	err := r.database.Transact(ctx, func(tx *sqlx.Tx) error {
+		query := `
+		SELECT id, user_id, name, playlist_id, tracks, snapshot_id, built_at, created_at
+		FROM playlist_versions
+		WHERE user_id = $1 AND playlist_id = $2
+		ORDER BY created_at DESC
+		`
+		rows, err := tx.QueryxContext(ctx, query, userID, playlistID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var envelope VersionEnvelope
+			if err := rows.StructScan(&envelope); err != nil {
+				return err
+			}
+			envelope.Version.TrackIDs = toIDs(envelope.Tracks)
+			versions = append(versions, envelope.Version)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+func (r *Registry) ListVersionsBetween(ctx context.Context, userID string, from, to time.Time) ([]*Version, error) {
+	var versions []*Version
+	err := r.database.Transact(ctx, func(tx *sqlx.Tx) error {
+		query := `
+		SELECT id, user_id, name, playlist_id, tracks, snapshot_id, built_at, created_at
+		FROM playlist_versions
+		WHERE user_id = $1 AND COALESCE(built_at, created_at) >= $2 AND COALESCE(built_at, created_at) < $3
+		ORDER BY COALESCE(built_at, created_at) ASC
+		`
+		rows, err := tx.QueryxContext(ctx, query, userID, from, to)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var envelope VersionEnvelope
+			if err := rows.StructScan(&envelope); err != nil {
+				return err
+			}
+			envelope.Version.TrackIDs = toIDs(envelope.Tracks)
+			versions = append(versions, envelope.Version)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+func (r *Registry) GetVersion(ctx context.Context, userID, versionID string) (*Version, error) {
+	var envelope VersionEnvelope
+	err := r.database.Transact(ctx, func(tx *sqlx.Tx) error {
+		query := `
+		SELECT id, user_id, name, playlist_id, tracks, snapshot_id, built_at, created_at
+		FROM playlist_versions
+		WHERE user_id = $1 AND id = $2
+		`
+		row := tx.QueryRowxContext(ctx, query, userID, versionID)
+		return row.StructScan(&envelope)
+	})
+	if err != nil {
+		var pqErr *pq.Error
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrVersionNotFound
+		case errors.As(err, &pqErr) && pqErr.Code.Name() == "invalid_text_representation":
+			return nil, ErrVersionNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	envelope.Version.TrackIDs = toIDs(envelope.Tracks)
+
+	return envelope.Version, nil
+}
+
+func (r *Registry) CreateVersion(ctx context.Context, playlist *Playlist) (string, error) {
+	version := &Version{
+		UserID:     playlist.UserID,
+		Name:       playlist.Name,
+		PlaylistID: playlist.ID,
+		TrackIDs:   playlist.TrackIDs,
+		SnapshotID: playlist.SnapshotID,
+		BuiltAt:    playlist.BuiltAt,
+	}
+
+	envelope := &VersionEnvelope{
+		Version: version,
+		Tracks:  toStringArray(version.TrackIDs),
+	}
+
+	err := r.database.Transact(ctx, func(tx *sqlx.Tx) error {
+		query := `
+		INSERT INTO playlist_versions (user_id, name, playlist_id, tracks, snapshot_id, built_at)
+		VALUES (:user_id, :name, :playlist_id, :tracks, :snapshot_id, :built_at)
+		RETURNING id
+		`
+		stmt, err := tx.PrepareNamedContext(ctx, query)
+		if err != nil {
+			return err
+		}
+		row := stmt.QueryRowxContext(ctx, envelope)
+		return row.Scan(&version.ID)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return version.ID, nil
+}
@@ -0,0 +1,44 @@
+package playlists
+
+import (
+	"context"
+	"errors"
+)
+
+const (
+	ModeNew     string = "new"
+	ModeRolling string = "rolling"
+)
+
+const (
+	RollingPlaylistName = "Spautofy: Current Top"
+)
+
+func (b *Builder) prepareRolling(ctx context.Context, playlist *Playlist) (string, error) {
+	previous, err := b.registry.GetLatest(ctx, playlist.UserID, playlist.Name)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrPlaylistNotFound):
+			return b.registry.Create(ctx, playlist)
+		default:
+			return "", err
+		}
+	}
+
+	// keep the tracks from the last build so that earlier versions can still be browsed
+	if previous.SnapshotID != "" {
+		_, err = b.registry.CreateVersion(ctx, previous)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	playlist.ID = previous.ID
+	playlist.SpotifyID = previous.SpotifyID
+	playlist.SpotifyURL = previous.SpotifyURL
+	if playlist.SpotifyID != "" {
+		playlist.BuildStep = BuildStepCreated
+	}
+
+	return b.registry.Update(ctx, playlist)
+}
@@ -0,0 +1,278 @@
+package playlists
+
+import (
+	"sort"
+
+	"github.com/zmb3/spotify"
+
+	"github.com/jace-ys/spautofy/pkg/accounts"
+)
+
+const (
+	SourceTopTracks       string = "top-tracks"
+	SourceArtistTopTracks string = "artist-top-tracks"
+	SourceArtistReleases  string = "artist-releases"
+)
+
+const (
+	maxTopTracksPageSize    = 50
+	maxTopArtistsPageSize   = 50
+	maxArtistAlbumsPageSize = 50
+	market                  = "from_token"
+)
+
+type TrackSource interface {
+	Tracks(count int, timerange string, exclude map[spotify.ID]bool) ([]spotify.ID, error)
+}
+
+// TrackFilter narrows down candidate tracks, keeping them in order
+type TrackFilter func(trackIDs []spotify.ID) ([]spotify.ID, error)
+
+func filterTracks(filter TrackFilter, trackIDs []spotify.ID) ([]spotify.ID, error) {
+	if filter == nil || len(trackIDs) == 0 {
+		return trackIDs, nil
+	}
+	return filter(trackIDs)
+}
+
+func (b *Builder) trackSource(account *accounts.Account) TrackSource {
+	// filters are applied as the sources page through their candidates, so each page is only fetched once
+	var filter TrackFilter
+	if len(account.GenreInclude) > 0 || len(account.GenreExclude) > 0 {
+		filter = b.genreFilter(account.GenreInclude, account.GenreExclude)
+	}
+
+	switch account.Source {
+	case SourceArtistTopTracks, SourceArtistReleases:
+		perArtist := account.ArtistTrackLimit
+		if perArtist <= 0 {
+			perArtist = 1
+		}
+
+		return &topArtistsSource{
+			client:    b.client,
+			perArtist: perArtist,
+			releases:  account.Source == SourceArtistReleases,
+			filter:    filter,
+		}
+	default:
+		return &topTracksSource{
+			client: b.client,
+			filter: filter,
+		}
+	}
+}
+
+type topTracksSource struct {
+	client Client
+	filter TrackFilter
+}
+
+func (s *topTracksSource) Tracks(count int, timerange string, exclude map[spotify.ID]bool) ([]spotify.ID, error) {
+	skip := make(map[spotify.ID]bool, len(exclude))
+	for id := range exclude {
+		skip[id] = true
+	}
+
+	// Spotify only returns a limited number of top tracks per time range, so larger playlists are topped up from the others
+	var trackIDs []spotify.ID
+	for _, tr := range fallbackTimeranges(timerange) {
+		tracks, err := s.topTracks(count-len(trackIDs), tr, skip)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, id := range tracks {
+			skip[id] = true
+		}
+		trackIDs = append(trackIDs, tracks...)
+
+		if len(trackIDs) == count {
+			break
+		}
+	}
+
+	return trackIDs, nil
+}
+
+func fallbackTimeranges(timerange string) []string {
+	timeranges := []string{timerange}
+	for _, tr := range []string{TimerangeMedium, TimerangeLong, TimerangeShort} {
+		if tr != timerange {
+			timeranges = append(timeranges, tr)
+		}
+	}
+	return timeranges
+}
+
+func (s *topTracksSource) topTracks(count int, timerange string, exclude map[spotify.ID]bool) ([]spotify.ID, error) {
+	limit := count
+	if len(exclude) > 0 || s.filter != nil || limit > maxTopTracksPageSize {
+		limit = maxTopTracksPageSize
+	}
+
+	// page further down the top tracks to backfill any that have been excluded or filtered out
+	var trackIDs []spotify.ID
+	for offset := 0; len(trackIDs) < count; offset += limit {
+		opts := &spotify.Options{
+			Limit:     &limit,
+			Offset:    &offset,
+			Timerange: &timerange,
+		}
+
+		tracks, err := s.client.CurrentUsersTopTracksOpt(opts)
+		if err != nil {
+			return nil, err
+		}
+
+		var candidates []spotify.ID
+		for _, track := range tracks.Tracks {
+			if !exclude[track.ID] {
+				candidates = append(candidates, track.ID)
+			}
+		}
+
+		candidates, err = filterTracks(s.filter, candidates)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, id := range candidates {
+			if len(trackIDs) == count {
+				break
+			}
+
+			trackIDs = append(trackIDs, id)
+		}
+
+		if tracks.Next == "" {
+			break
+		}
+	}
+
+	return trackIDs, nil
+}
+
+type topArtistsSource struct {
+	client    Client
+	perArtist int
+	releases  bool
+	filter    TrackFilter
+}
+
+func (s *topArtistsSource) Tracks(count int, timerange string, exclude map[spotify.ID]bool) ([]spotify.ID, error) {
+	seen := make(map[spotify.ID]bool)
+
+	var trackIDs []spotify.ID
+	limit := maxTopArtistsPageSize
+	for offset := 0; len(trackIDs) < count; offset += limit {
+		opts := &spotify.Options{
+			Limit:     &limit,
+			Offset:    &offset,
+			Timerange: &timerange,
+		}
+
+		artists, err := s.client.CurrentUsersTopArtistsOpt(opts)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, artist := range artists.Artists {
+			if len(trackIDs) == count {
+				break
+			}
+
+			artistTrackIDs, err := s.artistTracks(artist.ID)
+			if err != nil {
+				return nil, err
+			}
+
+			var candidates []spotify.ID
+			for _, id := range artistTrackIDs {
+				if !exclude[id] && !seen[id] {
+					candidates = append(candidates, id)
+				}
+			}
+
+			// the cap on tracks per artist applies to what is left once filtered
+			candidates, err = filterTracks(s.filter, candidates)
+			if err != nil {
+				return nil, err
+			}
+
+			var added int
+			for _, id := range candidates {
+				if added == s.perArtist || len(trackIDs) == count {
+					break
+				}
+				seen[id] = true
+
+				trackIDs = append(trackIDs, id)
+				added++
+			}
+		}
+
+		if artists.Next == "" {
+			break
+		}
+	}
+
+	return trackIDs, nil
+}
+
+func (s *topArtistsSource) artistTracks(artistID spotify.ID) ([]spotify.ID, error) {
+	if s.releases {
+		return s.latestReleaseTracks(artistID)
+	}
+
+	tracks, err := s.client.GetArtistsTopTracks(artistID, market)
+	if err != nil {
+		return nil, err
+	}
+
+	trackIDs := make([]spotify.ID, len(tracks))
+	for idx, track := range tracks {
+		trackIDs[idx] = track.ID
+	}
+
+	return trackIDs, nil
+}
+
+func (s *topArtistsSource) latestReleaseTracks(artistID spotify.ID) ([]spotify.ID, error) {
+	limit := maxArtistAlbumsPageSize
+	country := market
+	opts := &spotify.Options{
+		Limit:   &limit,
+		Country: &country,
+	}
+
+	// only ask for the artist's own releases, leaving out compilations and features on other artists' releases
+	albums, err := s.client.GetArtistAlbumsOpt(artistID, opts, spotify.AlbumTypeAlbum, spotify.AlbumTypeSingle)
+	if err != nil {
+		return nil, err
+	}
+
+	releases := albums.Albums
+
+	sort.SliceStable(releases, func(i, j int) bool {
+		return releases[i].ReleaseDate > releases[j].ReleaseDate
+	})
+
+	var trackIDs []spotify.ID
+	for _, release := range releases {
+		if len(trackIDs) >= s.perArtist {
+			break
+		}
+
+		tracks, err := s.client.GetAlbumTracks(release.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, track := range tracks.Tracks {
+			trackIDs = append(trackIDs, track.ID)
+		}
+	}
+
+	return trackIDs, nil
+}
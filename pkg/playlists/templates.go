@@ -0,0 +1,96 @@
+package playlists
+
+import (
+	"errors"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/zmb3/spotify"
+)
+
+const (
+	DefaultNameTemplate        = `{{ .Period }}`
+	DefaultDescriptionTemplate = `A playlist put together for you by Spautofy based on your recent top tracks.`
+)
+
+var (
+	ErrTemplateEmptyName = errors.New("playlist name template renders an empty name")
+)
+
+type TemplateData struct {
+	Period     string
+	Frequency  string
+	TrackCount int
+	TopArtist  string
+	FirstName  string
+}
+
+func NewTemplateData(now time.Time, frequency string, trackCount int, topArtist, firstName string) *TemplateData {
+	return &TemplateData{
+		Period:     now.Format("Jan 2006"),
+		Frequency:  frequency,
+		TrackCount: trackCount,
+		TopArtist:  topArtist,
+		FirstName:  firstName,
+	}
+}
+
+func (d *TemplateData) Render(text string) (string, error) {
+	tmpl, err := template.New("playlist").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, d); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(b.String()), nil
+}
+
+func (d *TemplateData) RenderNameAndDescription(nameTemplate, descriptionTemplate string) (string, string, error) {
+	if nameTemplate == "" {
+		nameTemplate = DefaultNameTemplate
+	}
+
+	if descriptionTemplate == "" {
+		descriptionTemplate = DefaultDescriptionTemplate
+	}
+
+	name, err := d.Render(nameTemplate)
+	if err != nil {
+		return "", "", err
+	}
+
+	if name == "" {
+		return "", "", ErrTemplateEmptyName
+	}
+
+	description, err := d.Render(descriptionTemplate)
+	if err != nil {
+		return "", "", err
+	}
+
+	return name, description, nil
+}
+
+func (b *Builder) topArtist(timerange string) (string, error) {
+	limit := 1
+	opts := &spotify.Options{
+		Limit:     &limit,
+		Timerange: &timerange,
+	}
+
+	artists, err := b.client.CurrentUsersTopArtistsOpt(opts)
+	if err != nil {
+		return "", err
+	}
+
+	if len(artists.Artists) == 0 {
+		return "", nil
+	}
+
+	return artists.Artists[0].Name, nil
+}
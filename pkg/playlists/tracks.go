@@ -0,0 +1,308 @@
+package playlists
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/jace-ys/go-library/postgres"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/zmb3/spotify"
+)
+
+type Track struct {
+	ID          spotify.ID
+	Name        string
+	Artists     string
+	Album       string
+	ISRC        string
+	Duration    time.Duration
+	URI         spotify.URI
+	PreviewURL  string
+	ArtworkURL  string
+	Recommended bool
+}
+
+func fetchFullTracks(client Client, trackIDs []spotify.ID) ([]*spotify.FullTrack, error) {
+	var tracks []*spotify.FullTrack
+	for start := 0; start < len(trackIDs); start += maxTracksBatchSize {
+		end := start + maxTracksBatchSize
+		if end > len(trackIDs) {
+			end = len(trackIDs)
+		}
+
+		batch, err := client.GetTracks(trackIDs[start:end]...)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, track := range batch {
+			if track != nil {
+				tracks = append(tracks, track)
+			}
+		}
+	}
+
+	return tracks, nil
+}
+
+func fetchTracks(client Client, trackIDs []spotify.ID) ([]*Track, error) {
+	spotifyTracks, err := fetchFullTracks(client, trackIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	tracks := make([]*Track, len(spotifyTracks))
+	for i, track := range spotifyTracks {
+		tracks[i] = &Track{
+			ID:         track.ID,
+			Name:       track.Name,
+			Album:      track.Album.Name,
+			ISRC:       track.ExternalIDs["isrc"],
+			Duration:   time.Duration(track.Duration) * time.Millisecond,
+			URI:        track.URI,
+			PreviewURL: track.PreviewURL,
+		}
+
+		if len(track.Album.Images) > 0 {
+			tracks[i].ArtworkURL = track.Album.Images[0].URL
+		}
+
+		artists := make([]string, len(track.Artists))
+		for j, artist := range track.Artists {
+			artists[j] = artist.Name
+		}
+
+		tracks[i].Artists = strings.Join(artists, ", ")
+	}
+
+	return tracks, nil
+}
+
+// FetchTracks reads tracks from the cache, only falling back to Spotify for tracks that have not been cached yet. A
+// client for the user is only built when some are missing, so cached tracks can still be read once their token has
+// been revoked.
+func (bf *BuilderFactory) FetchTracks(ctx context.Context, logger log.Logger, userID string, trackIDs []spotify.ID) ([]*Track, error) {
+	cached, err := bf.tracks.List(ctx, trackIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[spotify.ID]*Track, len(cached))
+	for _, track := range cached {
+		found[track.ID] = track
+	}
+
+	var missing []spotify.ID
+	for _, id := range trackIDs {
+		if _, ok := found[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+
+	if len(missing) > 0 {
+		builder, err := bf.NewBuilder(ctx, logger, userID)
+		if err != nil {
+			return nil, err
+		}
+
+		fetched, err := fetchTracks(builder.client, missing)
+		if err != nil {
+			return nil, err
+		}
+
+		err = bf.tracks.Upsert(ctx, fetched)
+		if err != nil {
+			logger.Log("event", "tracks.cache.failed", "error", err)
+		}
+
+		for _, track := range fetched {
+			found[track.ID] = track
+		}
+	}
+
+	tracks := make([]*Track, 0, len(trackIDs))
+	for _, id := range trackIDs {
+		if track, ok := found[id]; ok {
+			tracks = append(tracks, track)
+		}
+	}
+
+	return tracks, nil
+}
+
+func (b *Builder) cacheTracks(ctx context.Context, trackIDs []spotify.ID) error {
+	tracks, err := fetchTracks(b.client, trackIDs)
+	if err != nil {
+		return err
+	}
+
+	return b.tracks.Upsert(ctx, tracks)
+}
+
+// RefreshTracks re-fetches cached tracks that are older than maxAge, so that renamed or relinked tracks do not go stale
+func RefreshTracks(ctx context.Context, client Client, registry *TrackRegistry, maxAge time.Duration, limit int) (int, error) {
+	trackIDs, err := registry.ListStale(ctx, time.Now().Add(-maxAge), limit)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(trackIDs) == 0 {
+		return 0, nil
+	}
+
+	tracks, err := fetchTracks(client, trackIDs)
+	if err != nil {
+		return 0, err
+	}
+
+	err = registry.Upsert(ctx, tracks)
+	if err != nil {
+		return 0, err
+	}
+
+	// tracks Spotify no longer returns are kept as they are, but are moved to the back of the queue so that they do
+	// not hold up every other stale track
+	returned := make(map[spotify.ID]bool, len(tracks))
+	for _, track := range tracks {
+		returned[track.ID] = true
+	}
+
+	var unavailable []spotify.ID
+	for _, id := range trackIDs {
+		if !returned[id] {
+			unavailable = append(unavailable, id)
+		}
+	}
+
+	if len(unavailable) > 0 {
+		err = registry.Touch(ctx, unavailable)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(tracks), nil
+}
+
+type TrackEnvelope struct {
+	*Track
+	DurationMs int64
+	UpdatedAt  time.Time
+}
+
+type TrackRegistry struct {
+	database *postgres.Client
+}
+
+func NewTrackRegistry(postgres *postgres.Client) *TrackRegistry {
+	return &TrackRegistry{
+		database: postgres,
+	}
+}
+
+func (r *TrackRegistry) List(ctx context.Context, trackIDs []spotify.ID) ([]*Track, error) {
+	var tracks []*Track
+	err := r.database.Transact(ctx, func(tx *sqlx.Tx) error {
+		query := `
+		SELECT id, name, artists, album, duration_ms, isrc, preview_url, artwork_url, updated_at
+		FROM tracks
+		WHERE id = ANY($1)
+		`
+		rows, err := tx.QueryxContext(ctx, query, toStringArray(trackIDs))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			envelope := TrackEnvelope{Track: &Track{}}
+			if err := rows.StructScan(&envelope); err != nil {
+				return err
+			}
+			envelope.Track.Duration = time.Duration(envelope.DurationMs) * time.Millisecond
+			envelope.Track.URI = spotify.URI(fmt.Sprintf("spotify:track:%s", envelope.Track.ID))
+			tracks = append(tracks, envelope.Track)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tracks, nil
+}
+
+func (r *TrackRegistry) ListStale(ctx context.Context, before time.Time, limit int) ([]spotify.ID, error) {
+	var ids pq.StringArray
+	err := r.database.Transact(ctx, func(tx *sqlx.Tx) error {
+		query := `
+		SELECT ARRAY(
+			SELECT id
+			FROM tracks
+			WHERE updated_at < $1
+			ORDER BY updated_at ASC
+			LIMIT $2
+		)
+		`
+		row := tx.QueryRowContext(ctx, query, before, limit)
+		return row.Scan(&ids)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return toIDs(ids), nil
+}
+
+func (r *TrackRegistry) Touch(ctx context.Context, trackIDs []spotify.ID) error {
+	return r.database.Transact(ctx, func(tx *sqlx.Tx) error {
+		query := `
+		UPDATE tracks SET
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = ANY($1)
+		`
+		_, err := tx.ExecContext(ctx, query, toStringArray(trackIDs))
+		return err
+	})
+}
+
+func (r *TrackRegistry) Upsert(ctx context.Context, tracks []*Track) error {
+	return r.database.Transact(ctx, func(tx *sqlx.Tx) error {
+		query := `
+		INSERT INTO tracks (id, name, artists, album, duration_ms, isrc, preview_url, artwork_url)
+		VALUES (:id, :name, :artists, :album, :duration_ms, :isrc, :preview_url, :artwork_url)
+		ON CONFLICT (id)
+		DO UPDATE SET
+			name = EXCLUDED.name,
+			artists = EXCLUDED.artists,
+			album = EXCLUDED.album,
+			duration_ms = EXCLUDED.duration_ms,
+			isrc = EXCLUDED.isrc,
+			preview_url = EXCLUDED.preview_url,
+			artwork_url = EXCLUDED.artwork_url,
+			updated_at = CURRENT_TIMESTAMP
+		`
+		stmt, err := tx.PrepareNamedContext(ctx, query)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, track := range tracks {
+			envelope := &TrackEnvelope{
+				Track:      track,
+				DurationMs: track.Duration.Milliseconds(),
+			}
+
+			_, err := stmt.ExecContext(ctx, envelope)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,58 @@
+package playlists
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/zmb3/spotify"
+
+	"github.com/jace-ys/spautofy/pkg/accounts"
+)
+
+const (
+	VisibilityPrivate       string = "private"
+	VisibilityPublic        string = "public"
+	VisibilityCollaborative string = "collaborative"
+)
+
+var (
+	ErrVisibilityNotGranted = errors.New("scopes for playlist visibility not granted")
+)
+
+// VisibilityScopes returns the scopes a visibility needs beyond those every login grants. Collaborative playlists
+// are created as private ones, so only public playlists need more.
+func VisibilityScopes(visibility string) []string {
+	switch visibility {
+	case VisibilityPublic:
+		return []string{spotify.ScopePlaylistModifyPublic}
+	default:
+		return nil
+	}
+}
+
+func (b *Builder) visibility(account *accounts.Account) string {
+	// fall back to a private playlist until the user has granted the scopes needed
+	if !b.user.HasScopes(VisibilityScopes(account.Visibility)...) {
+		b.logger.Log("event", "playlist.visibility.downgraded", "visibility", account.Visibility)
+		return VisibilityPrivate
+	}
+
+	return account.Visibility
+}
+
+// requireVisibility fails rather than falling back to a private playlist, for playlists that others need to open
+func (b *Builder) requireVisibility(visibility string) error {
+	if !b.user.HasScopes(VisibilityScopes(visibility)...) {
+		return fmt.Errorf("%w: %s", ErrVisibilityNotGranted, visibility)
+	}
+	return nil
+}
+
+func (b *Builder) createForUser(playlist *Playlist, visibility string) (*spotify.FullPlaylist, error) {
+	switch visibility {
+	case VisibilityCollaborative:
+		return b.client.CreateCollaborativePlaylistForUser(playlist.UserID, playlist.Name, playlist.Description)
+	default:
+		return b.client.CreatePlaylistForUser(playlist.UserID, playlist.Name, playlist.Description, visibility == VisibilityPublic)
+	}
+}
@@ -0,0 +1,246 @@
+package playlists
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/zmb3/spotify"
+
+	"github.com/jace-ys/spautofy/pkg/accounts"
+	"github.com/jace-ys/spautofy/pkg/mail"
+)
+
+const (
+	// the review runs once the year is over, so that its last day counts too
+	WrappedSpec       = "0 0 1 1 *"
+	wrappedTrackLimit = 100
+)
+
+var (
+	ErrWrappedNoTracks = errors.New("no playlists found for year")
+)
+
+// WrappedYear returns the year that a review due at due covers, which is the one just ended
+func WrappedYear(due time.Time) int {
+	return due.AddDate(0, 0, -1).Year()
+}
+
+func WrappedPlaylistName(year int) string {
+	return fmt.Sprintf("Spautofy Year in Review %d", year)
+}
+
+type rankedTrack struct {
+	id          spotify.ID
+	score       float64
+	appearances int
+	first       int
+}
+
+// RankTracks scores every appearance of a track by its position in the list, so tracks that come up
+// often and near the top of their playlists rank highest
+func RankTracks(trackLists [][]spotify.ID) []spotify.ID {
+	ranked := make(map[spotify.ID]*rankedTrack)
+	var order int
+	for _, trackIDs := range trackLists {
+		for idx, id := range trackIDs {
+			track, ok := ranked[id]
+			if !ok {
+				track = &rankedTrack{id: id, first: order}
+				ranked[id] = track
+				order++
+			}
+			track.appearances++
+			track.score += 1 + float64(len(trackIDs)-idx)/float64(len(trackIDs))
+		}
+	}
+
+	tracks := make([]*rankedTrack, 0, len(ranked))
+	for _, track := range ranked {
+		tracks = append(tracks, track)
+	}
+
+	sort.Slice(tracks, func(i, j int) bool {
+		switch {
+		case tracks[i].score != tracks[j].score:
+			return tracks[i].score > tracks[j].score
+		case tracks[i].appearances != tracks[j].appearances:
+			return tracks[i].appearances > tracks[j].appearances
+		default:
+			return tracks[i].first < tracks[j].first
+		}
+	})
+
+	trackIDs := make([]spotify.ID, len(tracks))
+	for idx, track := range tracks {
+		trackIDs[idx] = track.id
+	}
+
+	return trackIDs
+}
+
+// RunWrapped builds the Year in Review for year, returning the ID of the playlist it produced. Nothing is built
+// when the user has no playlists from that year, or when its review has already been built.
+func (b *Builder) RunWrapped(ctx context.Context, account *accounts.Account, year int) (string, error) {
+	b.logger.Log("event", "wrapped.build.started", "year", year)
+
+	playlist, stats, err := b.NewWrappedPlaylist(ctx, year)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrWrappedNoTracks):
+			b.logger.Log("event", "wrapped.build.skipped", "year", year)
+			return "", nil
+		default:
+			b.logger.Log("event", "wrapped.new.failed", "error", err)
+			return "", fmt.Errorf("failed to select tracks: %w", err)
+		}
+	}
+
+	previous, err := b.registry.GetLatest(ctx, playlist.UserID, playlist.Name)
+	switch {
+	case errors.Is(err, ErrPlaylistNotFound):
+		_, err = b.registry.Create(ctx, playlist)
+		if err != nil {
+			b.logger.Log("event", "wrapped.create.failed", "error", err)
+			return "", fmt.Errorf("failed to create playlist: %w", err)
+		}
+	case err != nil:
+		b.logger.Log("event", "wrapped.create.failed", "error", err)
+		return "", fmt.Errorf("failed to create playlist: %w", err)
+	case previous.BuildStep == BuildStepFinished:
+		b.logger.Log("event", "wrapped.build.skipped", "year", year, "id", previous.ID)
+		return previous.ID, nil
+	default:
+		b.logger.Log("event", "playlist.build.resumed", "id", previous.ID, "step", previous.BuildStep)
+		playlist = previous
+	}
+
+	if err := b.cacheTracks(ctx, playlist.TrackIDs); err != nil {
+		b.logger.Log("event", "tracks.cache.failed", "error", err)
+	}
+
+	err = b.Build(ctx, account, playlist)
+	if err != nil {
+		b.logger.Log("event", "wrapped.build.failed", "error", err)
+		return playlist.ID, fmt.Errorf("failed to build playlist: %w", err)
+	}
+
+	b.logger.Log("event", "wrapped.build.finished", "id", playlist.ID)
+
+	accountURL := *b.baseURL
+	accountURL.Path = path.Join(accountURL.Path, "accounts", b.user.ID)
+
+	err = b.mailer.SendWrappedEmail(b.user, stats, playlist.SpotifyURL, accountURL.String())
+	if err != nil {
+		b.logger.Log("event", "email.send.failed", "error", err)
+		return playlist.ID, fmt.Errorf("failed to send email: %w", err)
+	}
+
+	b.logger.Log("event", "email.sent", "email", b.user.Email)
+
+	return playlist.ID, nil
+}
+
+func (b *Builder) NewWrappedPlaylist(ctx context.Context, year int) (*Playlist, *mail.WrappedStats, error) {
+	// the year is bounded in the scheduler's time zone, as that is where its runs fall due
+	from := time.Date(year, time.January, 1, 0, 0, 0, 0, time.Local)
+	to := from.AddDate(1, 0, 0)
+
+	history, err := b.registry.ListBetween(ctx, b.user.ID, from, to)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var trackLists [][]spotify.ID
+	var count int
+	for _, playlist := range history {
+		// earlier reviews repeat tracks already counted and group blends hold other members' tracks, while drafts
+		// were never added to the user's library, so none of them count towards the year
+		if playlist.Kind != KindPersonal || playlist.BuildStep != BuildStepFinished {
+			continue
+		}
+		trackLists = append(trackLists, playlist.TrackIDs)
+		count++
+	}
+
+	// rolling playlists are refreshed in place, so their earlier track lists only live on as versions. Both are
+	// matched by when their tracks were built, as a rolling playlist keeps the date it was first created.
+	versions, err := b.registry.ListVersionsBetween(ctx, b.user.ID, from, to)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, version := range versions {
+		trackLists = append(trackLists, version.TrackIDs)
+		count++
+	}
+
+	trackIDs := RankTracks(trackLists)
+	if len(trackIDs) == 0 {
+		return nil, nil, ErrWrappedNoTracks
+	}
+
+	stats := &mail.WrappedStats{
+		Year:      year,
+		Playlists: count,
+		Tracks:    len(trackIDs),
+	}
+
+	stats.TopTrack, stats.TopArtist, err = b.wrappedTopPicks(trackLists, trackIDs[0])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(trackIDs) > wrappedTrackLimit {
+		trackIDs = trackIDs[:wrappedTrackLimit]
+	}
+
+	return &Playlist{
+		UserID:      b.user.ID,
+		Kind:        KindWrapped,
+		Name:        WrappedPlaylistName(year),
+		Description: fmt.Sprintf("%s's top %d tracks of %d, from %d Spautofy playlists", b.user.FirstName(), len(trackIDs), year, count),
+		TrackIDs:    trackIDs,
+		BuildStep:   BuildStepPending,
+	}, stats, nil
+}
+
+func (b *Builder) wrappedTopPicks(trackLists [][]spotify.ID, topTrackID spotify.ID) (string, string, error) {
+	appearances := make(map[spotify.ID]int)
+	var trackIDs []spotify.ID
+	for _, list := range trackLists {
+		for _, id := range list {
+			if appearances[id] == 0 {
+				trackIDs = append(trackIDs, id)
+			}
+			appearances[id]++
+		}
+	}
+
+	tracks, err := fetchFullTracks(b.client, trackIDs)
+	if err != nil {
+		return "", "", err
+	}
+
+	var topTrack, topArtist string
+	artistCounts := make(map[spotify.ID]int)
+	var best int
+	for _, track := range tracks {
+		if track.ID == topTrackID && len(track.Artists) > 0 {
+			topTrack = fmt.Sprintf("%s by %s", track.Name, track.Artists[0].Name)
+		}
+
+		for _, artist := range track.Artists {
+			artistCounts[artist.ID] += appearances[track.ID]
+			if artistCounts[artist.ID] > best {
+				best = artistCounts[artist.ID]
+				topArtist = artist.Name
+			}
+		}
+	}
+
+	return topTrack, topArtist, nil
+}
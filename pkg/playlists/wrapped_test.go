@@ -0,0 +1,74 @@
+package playlists
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zmb3/spotify"
+)
+
+func equalIDs(a, b []spotify.ID) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for idx := range a {
+		if a[idx] != b[idx] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRankTracks(t *testing.T) {
+	tests := []struct {
+		name       string
+		trackLists [][]spotify.ID
+		ranked     []spotify.ID
+	}{
+		{
+			name: "no playlists",
+		},
+		{
+			name:       "single playlist keeps its order",
+			trackLists: [][]spotify.ID{{"a", "b", "c"}},
+			ranked:     []spotify.ID{"a", "b", "c"},
+		},
+		{
+			name:       "frequent tracks rank above top tracks",
+			trackLists: [][]spotify.ID{{"a", "b", "c"}, {"c", "d", "e"}, {"c", "f", "g"}},
+			ranked:     []spotify.ID{"c", "a", "b", "d", "f", "e", "g"},
+		},
+		{
+			name:       "higher positions rank above lower ones",
+			trackLists: [][]spotify.ID{{"a", "b"}, {"b", "a"}, {"b", "c"}},
+			ranked:     []spotify.ID{"b", "a", "c"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if ranked := RankTracks(tt.trackLists); !equalIDs(ranked, tt.ranked) {
+				t.Errorf("expected %v, got %v", tt.ranked, ranked)
+			}
+		})
+	}
+}
+
+func TestWrappedYear(t *testing.T) {
+	tests := []struct {
+		due  time.Time
+		year int
+	}{
+		{due: time.Date(2021, time.January, 1, 0, 0, 0, 0, time.Local), year: 2020},
+		{due: time.Date(2021, time.January, 1, 23, 0, 0, 0, time.Local), year: 2020},
+		{due: time.Date(2021, time.December, 31, 0, 0, 0, 0, time.Local), year: 2021},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.due.Format("2006-01-02 15:04"), func(t *testing.T) {
+			if year := WrappedYear(tt.due); year != tt.year {
+				t.Errorf("expected %d, got %d", tt.year, year)
+			}
+		})
+	}
+}
@@ -0,0 +1,249 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/google/uuid"
+	"github.com/jace-ys/go-library/postgres"
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	defaultLeaseTTL = 30 * time.Second
+)
+
+var (
+	ErrNotLeader = errors.New("not the scheduler leader")
+)
+
+var (
+	leaderGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: "spautofy",
+		Subsystem: "scheduler",
+		Name:      "leader",
+		Help:      "Whether this instance currently holds the scheduler lease.",
+	})
+
+	leaderTransitionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "spautofy",
+		Subsystem: "scheduler",
+		Name:      "leader_transitions_total",
+		Help:      "Number of times this instance gained or lost the scheduler lease.",
+	}, []string{"transition"})
+)
+
+// Elector holds a lease row in Postgres, so that only one instance runs schedules at a time. A leader that dies
+// without releasing its lease is replaced once the lease expires.
+type Elector struct {
+	logger   log.Logger
+	database *postgres.Client
+	name     string
+	holder   string
+	ttl      time.Duration
+
+	mu     sync.RWMutex
+	leader bool
+}
+
+func NewElector(logger log.Logger, postgres *postgres.Client, name string) *Elector {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	return &Elector{
+		logger:   logger,
+		database: postgres,
+		name:     name,
+		holder:   fmt.Sprintf("%s-%s", hostname, uuid.New()),
+		ttl:      defaultLeaseTTL,
+	}
+}
+
+func (e *Elector) IsLeader() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.leader
+}
+
+// Check reports whether this instance is the leader, for use as a health observer
+func (e *Elector) Check(ctx context.Context) error {
+	if !e.IsLeader() {
+		return ErrNotLeader
+	}
+	return nil
+}
+
+// Run campaigns for the lease until ctx is done, calling lead with a context that is cancelled as soon as the
+// lease is lost. The lease is released on return, so another instance can take over straight away.
+func (e *Elector) Run(ctx context.Context, lead func(ctx context.Context) error) error {
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+
+	// a follower can take the lease over as soon as it expires, so the leader steps down a while before then
+	// unless it has been renewed
+	expiry := time.NewTimer(e.ttl)
+	stopTimer(expiry)
+	defer stopTimer(expiry)
+
+	var cancel context.CancelFunc
+	errs := make(chan error, 1)
+
+	stop := func() error {
+		stopTimer(expiry)
+		if cancel == nil {
+			return nil
+		}
+
+		cancel()
+		cancel = nil
+		e.setLeader(false)
+
+		return <-errs
+	}
+
+	for {
+		// the lease is counted from when it was asked for, as the database sets its expiry some time after that
+		attempted := time.Now()
+		acquired, err := e.acquire(ctx)
+		if err != nil && ctx.Err() == nil {
+			e.logger.Log("event", "leader.acquire.failed", "error", err)
+		}
+		if acquired {
+			resetTimer(expiry, time.Until(attempted.Add(e.ttl-e.ttl/3)))
+		}
+
+		// keep leading through a transient error, until the expiry timer says otherwise
+		lost := !acquired && err == nil
+
+		switch {
+		case acquired && cancel == nil:
+			e.setLeader(true)
+
+			var leaderCtx context.Context
+			leaderCtx, cancel = context.WithCancel(ctx)
+			go func() {
+				errs <- lead(leaderCtx)
+			}()
+		case lost && cancel != nil:
+			if err := stop(); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case err := <-errs:
+			cancel()
+			e.setLeader(false)
+			e.release()
+			return err
+		case <-expiry.C:
+			e.logger.Log("event", "leader.lease.expiring", "holder", e.holder)
+			if err := stop(); err != nil {
+				return err
+			}
+		case <-ticker.C:
+			continue
+		case <-ctx.Done():
+			err := stop()
+			e.release()
+			return err
+		}
+	}
+}
+
+func stopTimer(timer *time.Timer) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+}
+
+func resetTimer(timer *time.Timer, d time.Duration) {
+	stopTimer(timer)
+	timer.Reset(d)
+}
+
+func (e *Elector) setLeader(leader bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.leader == leader {
+		return
+	}
+	e.leader = leader
+
+	if leader {
+		leaderGauge.Set(1)
+		leaderTransitionsTotal.WithLabelValues("elected").Inc()
+		e.logger.Log("event", "leader.elected", "holder", e.holder)
+	} else {
+		leaderGauge.Set(0)
+		leaderTransitionsTotal.WithLabelValues("demoted").Inc()
+		e.logger.Log("event", "leader.demoted", "holder", e.holder)
+	}
+}
+
+func (e *Elector) acquire(ctx context.Context) (bool, error) {
+	// a hanging attempt would otherwise hold up the expiry timer
+	ctx, cancel := context.WithTimeout(ctx, e.ttl/6)
+	defer cancel()
+
+	var holder string
+	err := e.database.Transact(ctx, func(tx *sqlx.Tx) error {
+		query := `
+		INSERT INTO leader_leases (name, holder, expires_at)
+		VALUES ($1, $2, CURRENT_TIMESTAMP + make_interval(secs => $3))
+		ON CONFLICT (name)
+		DO UPDATE SET
+			holder = EXCLUDED.holder,
+			expires_at = EXCLUDED.expires_at
+		WHERE leader_leases.holder = EXCLUDED.holder OR leader_leases.expires_at < CURRENT_TIMESTAMP
+		RETURNING holder
+		`
+		row := tx.QueryRowContext(ctx, query, e.name, e.holder, e.ttl.Seconds())
+		return row.Scan(&holder)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	return holder == e.holder, nil
+}
+
+func (e *Elector) release() {
+	// the parent context is usually done by now, but the lease should still be handed over
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := e.database.Transact(ctx, func(tx *sqlx.Tx) error {
+		query := `
+		DELETE FROM leader_leases
+		WHERE name = $1 AND holder = $2
+		`
+		_, err := tx.ExecContext(ctx, query, e.name, e.holder)
+		return err
+	})
+	if err != nil {
+		e.logger.Log("event", "leader.release.failed", "error", err)
+		return
+	}
+
+	e.logger.Log("event", "leader.released", "holder", e.holder)
+}
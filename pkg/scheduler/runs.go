@@ -0,0 +1,214 @@
+package scheduler
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	RunStatusRunning   string = "running"
+	RunStatusSucceeded string = "succeeded"
+	RunStatusFailed    string = "failed"
+)
+
+var (
+	jobRunsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "spautofy",
+		Subsystem: "scheduler",
+		Name:      "job_runs_total",
+		Help:      "Number of scheduled playlist builds that finished, by outcome.",
+	}, []string{"status"})
+
+	jobRunDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "spautofy",
+		Subsystem: "scheduler",
+		Name:      "job_run_duration_seconds",
+		Help:      "Time taken by scheduled playlist builds, by outcome.",
+		Buckets:   []float64{1, 5, 15, 30, 60, 120, 300, 600},
+	}, []string{"status"})
+)
+
+const (
+	errRunInterrupted = "run was interrupted before it finished"
+)
+
+type JobRun struct {
+	ID         string     `json:"id"`
+	Job        string     `json:"job"`
+	UserID     string     `json:"userID"`
+	Schedule   string     `json:"schedule"`
+	Status     string     `json:"status"`
+	PlaylistID string     `json:"playlistID,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	DueAt      *time.Time `json:"dueAt,omitempty"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+func (r *JobRun) Duration() time.Duration {
+	if r.FinishedAt == nil {
+		return 0
+	}
+	return r.FinishedAt.Sub(r.StartedAt)
+}
+
+// StartRun records a run of the job registered under key that was due at due, building a playlist for userID
+func (s *Scheduler) StartRun(ctx context.Context, key, userID, spec string, due time.Time) (*JobRun, error) {
+	run := &JobRun{
+		Job:      key,
+		UserID:   userID,
+		Schedule: spec,
+		Status:   RunStatusRunning,
+		DueAt:    &due,
+	}
+
+	err := s.database.Transact(ctx, func(tx *sqlx.Tx) error {
+		query := `
+		INSERT INTO job_runs (job, user_id, schedule, status, due_at)
+		VALUES (:job, :user_id, :schedule, :status, :due_at)
+		RETURNING id, started_at
+		`
+		stmt, err := tx.PrepareNamedContext(ctx, query)
+		if err != nil {
+			return err
+		}
+		row := stmt.QueryRowxContext(ctx, run)
+		return row.Scan(&run.ID, &run.StartedAt)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return run, nil
+}
+
+// FinishRun records the outcome of a run, which failed if runErr is set even when a playlist was produced
+func (s *Scheduler) FinishRun(ctx context.Context, run *JobRun, playlistID string, runErr error) error {
+	run.PlaylistID = playlistID
+	run.Status = RunStatusSucceeded
+	if runErr != nil {
+		run.Status = RunStatusFailed
+		run.Error = runErr.Error()
+	}
+
+	err := s.database.Transact(ctx, func(tx *sqlx.Tx) error {
+		query := `
+		UPDATE job_runs SET
+			status = :status,
+			playlist_id = :playlist_id,
+			error = :error,
+			finished_at = CURRENT_TIMESTAMP
+		WHERE id = :id
+		RETURNING finished_at
+		`
+		stmt, err := tx.PrepareNamedContext(ctx, query)
+		if err != nil {
+			return err
+		}
+		row := stmt.QueryRowxContext(ctx, run)
+		return row.Scan(&run.FinishedAt)
+	})
+	if err != nil {
+		return err
+	}
+
+	jobRunsTotal.WithLabelValues(run.Status).Inc()
+	jobRunDuration.WithLabelValues(run.Status).Observe(run.Duration().Seconds())
+
+	return nil
+}
+
+func (s *Scheduler) ListRuns(ctx context.Context, userID string, limit int) ([]*JobRun, error) {
+	return s.listRuns(ctx, `
+		SELECT id, job, user_id, schedule, status, playlist_id, error, due_at, started_at, finished_at
+		FROM job_runs
+		WHERE user_id = $1
+		ORDER BY started_at DESC
+		LIMIT $2
+		`, userID, limit)
+}
+
+func (s *Scheduler) ListRecentRuns(ctx context.Context, limit int) ([]*JobRun, error) {
+	return s.listRuns(ctx, `
+		SELECT id, job, user_id, schedule, status, playlist_id, error, due_at, started_at, finished_at
+		FROM job_runs
+		ORDER BY started_at DESC
+		LIMIT $1
+		`, limit)
+}
+
+// RunningJobs returns the keys of jobs that have a run in progress
+func (s *Scheduler) RunningJobs(ctx context.Context) (map[string]bool, error) {
+	var keys pq.StringArray
+	err := s.database.Transact(ctx, func(tx *sqlx.Tx) error {
+		query := `
+		SELECT ARRAY(
+			SELECT DISTINCT job
+			FROM job_runs
+			WHERE status = $1
+		)
+		`
+		row := tx.QueryRowContext(ctx, query, RunStatusRunning)
+		return row.Scan(&keys)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	running := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		running[key] = true
+	}
+
+	return running, nil
+}
+
+// FailStaleRuns resolves runs that have been running for longer than maxDuration, which were left behind by an
+// instance that stopped before it could record how they went. The runs are returned so that their claims can be
+// given up too.
+func (s *Scheduler) FailStaleRuns(ctx context.Context, maxDuration time.Duration) ([]*JobRun, error) {
+	runs, err := s.listRuns(ctx, `
+		UPDATE job_runs SET
+			status = $1,
+			error = $2,
+			finished_at = CURRENT_TIMESTAMP
+		WHERE status = $3 AND started_at < $4
+		RETURNING id, job, user_id, schedule, status, playlist_id, error, due_at, started_at, finished_at
+		`, RunStatusFailed, errRunInterrupted, RunStatusRunning, time.Now().Add(-maxDuration))
+	if err != nil {
+		return nil, err
+	}
+
+	jobRunsTotal.WithLabelValues(RunStatusFailed).Add(float64(len(runs)))
+
+	return runs, nil
+}
+
+func (s *Scheduler) listRuns(ctx context.Context, query string, args ...interface{}) ([]*JobRun, error) {
+	var runs []*JobRun
+	err := s.database.Transact(ctx, func(tx *sqlx.Tx) error {
+		rows, err := tx.QueryxContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var run JobRun
+			if err := rows.StructScan(&run); err != nil {
+				return err
+			}
+			runs = append(runs, &run)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return runs, nil
+}
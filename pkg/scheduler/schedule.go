@@ -1,24 +1,63 @@
 package scheduler
 
 import (
+	"errors"
 	"fmt"
 	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/robfig/cron/v3"
 )
 
 var (
-	specRe = regexp.MustCompile(`0 0 1 1\/([1-9]+) *`)
+	ErrInvalidSpec = errors.New("invalid schedule spec")
+)
+
+var (
+	specRe = regexp.MustCompile(`^0 0 1 1/([1-9][0-9]*) \*$`)
 )
 
 type Schedule struct {
-	ID        cron.EntryID
-	UserID    string
-	Spec      string
-	Cmd       cron.FuncJob
-	CreatedAt time.Time
+	ID            cron.EntryID
+	UserID        string
+	Spec          string
+	Cmd           cron.FuncJob
+	LastRunAt     *time.Time
+	LastSuccessAt *time.Time
+	CreatedAt     time.Time
+}
+
+// MissedRun returns the latest run of the schedule that was due since its last successful run but never
+// succeeded, as long as it is no more than maxLateness overdue. Older runs are given up on rather than run far
+// too late.
+func (s *Schedule) MissedRun(now time.Time, maxLateness time.Duration) (time.Time, bool) {
+	since := s.CreatedAt
+	if s.LastSuccessAt != nil {
+		since = *s.LastSuccessAt
+	}
+	return MissedRun(s.Spec, since, now, maxLateness)
+}
+
+// MissedRun returns the latest time spec was due after since and up to now, as long as it is no more than
+// maxLateness overdue
+func MissedRun(spec string, since, now time.Time, maxLateness time.Duration) (time.Time, bool) {
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	if earliest := now.Add(-maxLateness); since.Before(earliest) {
+		since = earliest
+	}
+
+	var missed time.Time
+	for next := schedule.Next(since); !next.IsZero() && !next.After(now); next = schedule.Next(next) {
+		missed = next
+	}
+
+	return missed, !missed.IsZero()
 }
 
 func NewSchedule(userID, spec string, cmd cron.FuncJob) *Schedule {
@@ -29,14 +68,65 @@ func NewSchedule(userID, spec string, cmd cron.FuncJob) *Schedule {
 	}
 }
 
+const (
+	FrequencyWeekly      string = "weekly"
+	FrequencyFortnightly string = "fortnightly"
+	FrequencyMonthly     string = "monthly"
+	FrequencyQuarterly   string = "quarterly"
+	FrequencyHalfYearly  string = "half-yearly"
+	FrequencyYearly      string = "yearly"
+	FrequencyCustom      string = "custom"
+)
+
+const (
+	// cron cannot count weeks, so fortnightly runs fall on fixed days of the month instead
+	fortnightlySpec = "0 0 1,15 * *"
+
+	// later days are left out as not every month has them
+	MaxMonthDay = 28
+
+	MinInterval       = 24 * time.Hour
+	minIntervalChecks = 10
+
+	maxLookback = 5 * 366 * 24 * time.Hour
+)
+
+// SpecToFrequency returns roughly how many times a year the spec runs
 func SpecToFrequency(spec string) int {
-	match := specRe.FindStringSubmatch(spec)
-	if len(match) < 2 {
+	// steps beyond a year only ever run in January, so they are left to be counted below
+	if match := specRe.FindStringSubmatch(spec); len(match) == 2 {
+		if step, _ := strconv.Atoi(match[1]); step <= 12 {
+			return 12 / step
+		}
+	}
+
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
 		return 0
 	}
 
-	step, _ := strconv.Atoi(match[1])
-	return 12 / step
+	// a year of runs is counted rather than measuring one interval, as intervals vary between months
+	start := time.Date(time.Now().Year(), time.January, 1, 0, 0, 0, 0, time.Local)
+	end := start.AddDate(1, 0, 0)
+
+	var count int
+	for next := schedule.Next(start.Add(-time.Second)); next.Before(end) && count < 366; next = schedule.Next(next) {
+		count++
+	}
+
+	return count
+}
+
+func SpecToDescription(spec string) string {
+	frequency, _, _ := ParseSpec(spec)
+	if frequency != FrequencyCustom {
+		return frequency
+	}
+
+	if specRe.MatchString(spec) {
+		return fmt.Sprintf("%d times a year", SpecToFrequency(spec))
+	}
+	return "scheduled"
 }
 
 func FrequencyToSpec(frequency int) string {
@@ -44,6 +134,236 @@ func FrequencyToSpec(frequency int) string {
 	return fmt.Sprintf("0 0 1 1/%d *", step)
 }
 
+// NewSpec builds the spec for one of the preset frequencies, or validates a custom spec as given
+func NewSpec(frequency string, weekday time.Weekday, day int, custom string) (string, error) {
+	switch frequency {
+	case FrequencyWeekly:
+		if weekday < time.Sunday || weekday > time.Saturday {
+			return "", fmt.Errorf("%w: invalid weekday: %d", ErrInvalidSpec, weekday)
+		}
+		return fmt.Sprintf("0 0 * * %d", weekday), nil
+	case FrequencyFortnightly:
+		return fortnightlySpec, nil
+	case FrequencyMonthly:
+		if day < 1 || day > MaxMonthDay {
+			return "", fmt.Errorf("%w: invalid day of month: %d", ErrInvalidSpec, day)
+		}
+		return fmt.Sprintf("0 0 %d * *", day), nil
+	case FrequencyQuarterly:
+		return FrequencyToSpec(4), nil
+	case FrequencyHalfYearly:
+		return FrequencyToSpec(2), nil
+	case FrequencyYearly:
+		return FrequencyToSpec(1), nil
+	case FrequencyCustom:
+		custom = strings.TrimSpace(custom)
+		schedule, err := cron.ParseStandard(custom)
+		if err != nil {
+			return "", fmt.Errorf("%w: %s", ErrInvalidSpec, err)
+		}
+
+		prev := schedule.Next(time.Now())
+		if prev.IsZero() {
+			// cron gives up on specs that never match, such as the 30th of February
+			return "", fmt.Errorf("%w: never runs", ErrInvalidSpec)
+		}
+
+		// intervals can vary between runs, so a few are checked against the minimum
+		for i := 0; i < minIntervalChecks; i++ {
+			next := schedule.Next(prev)
+			if next.IsZero() {
+				break
+			}
+			if next.Sub(prev) < MinInterval {
+				return "", fmt.Errorf("%w: runs more than once a day", ErrInvalidSpec)
+			}
+			prev = next
+		}
+		return custom, nil
+	default:
+		return "", fmt.Errorf("%w: invalid frequency: %s", ErrInvalidSpec, frequency)
+	}
+}
+
+// ParseSpec reverses NewSpec, falling back to a custom frequency for specs that match none of the presets
+func ParseSpec(spec string) (string, time.Weekday, int) {
+	if match := specRe.FindStringSubmatch(spec); len(match) == 2 {
+		switch step, _ := strconv.Atoi(match[1]); step {
+		case 1:
+			return FrequencyMonthly, time.Monday, 1
+		case 3:
+			return FrequencyQuarterly, time.Monday, 1
+		case 6:
+			return FrequencyHalfYearly, time.Monday, 1
+		case 12:
+			return FrequencyYearly, time.Monday, 1
+		}
+	}
+
+	if spec == fortnightlySpec {
+		return FrequencyFortnightly, time.Monday, 1
+	}
+
+	if match := weeklyRe.FindStringSubmatch(spec); len(match) == 2 {
+		weekday, _ := strconv.Atoi(match[1])
+		return FrequencyWeekly, time.Weekday(weekday), 1
+	}
+
+	if match := monthDayRe.FindStringSubmatch(spec); len(match) == 2 {
+		if day, _ := strconv.Atoi(match[1]); day <= MaxMonthDay {
+			return FrequencyMonthly, time.Monday, day
+		}
+	}
+
+	return FrequencyCustom, time.Monday, 1
+}
+
+// DescribeSpec describes when the spec runs in plain language
+func DescribeSpec(spec string) string {
+	frequency, weekday, day := ParseSpec(spec)
+	switch frequency {
+	case FrequencyWeekly:
+		return fmt.Sprintf("Every %s", weekday)
+	case FrequencyFortnightly:
+		return "On the 1st and 15th of every month"
+	case FrequencyMonthly:
+		return fmt.Sprintf("On the %s of every month", ordinal(day))
+	case FrequencyQuarterly:
+		return "On the 1st of every 3 months"
+	case FrequencyHalfYearly:
+		return "On the 1st of every 6 months"
+	case FrequencyYearly:
+		return "On the 1st of January every year"
+	}
+
+	if description, ok := descriptors[spec]; ok {
+		return description
+	}
+
+	if strings.HasPrefix(spec, "@every ") {
+		return fmt.Sprintf("Every %s", strings.TrimPrefix(spec, "@every "))
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return fmt.Sprintf("On the schedule %q", spec)
+	}
+	minute, hour, dom, month, dow := fields[0], fields[1], fields[2], fields[3], fields[4]
+
+	var parts []string
+	if isNumber(minute) && isNumber(hour) {
+		m, _ := strconv.Atoi(minute)
+		h, _ := strconv.Atoi(hour)
+		parts = append(parts, fmt.Sprintf("At %02d:%02d", h, m))
+	} else {
+		parts = append(parts, fmt.Sprintf("At minute %s past hour %s", describeField(minute, nil), describeField(hour, nil)))
+	}
+
+	if dom != "*" {
+		parts = append(parts, fmt.Sprintf("on day %s of the month", describeField(dom, nil)))
+	}
+
+	if dow != "*" {
+		parts = append(parts, fmt.Sprintf("on %s", describeField(dow, weekdayNames)))
+	}
+
+	if month != "*" {
+		parts = append(parts, fmt.Sprintf("in %s", describeField(month, monthNames)))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+var (
+	weeklyRe   = regexp.MustCompile(`^0 0 \* \* ([0-6])$`)
+	monthDayRe = regexp.MustCompile(`^0 0 ([1-9]|[12][0-9]|3[01]) \* \*$`)
+
+	descriptors = map[string]string{
+		"@yearly":   "On the 1st of January every year",
+		"@annually": "On the 1st of January every year",
+		"@monthly":  "On the 1st of every month",
+		"@weekly":   "Every Sunday",
+		"@daily":    "Every day",
+		"@midnight": "Every day",
+		"@hourly":   "Every hour",
+	}
+
+	weekdayNames = []string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday", "Sunday"}
+	monthNames   = []string{"", "January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"}
+)
+
+// describeField spells out a single cron field, naming values where names are given
+func describeField(field string, names []string) string {
+	if field == "*" {
+		return "every"
+	}
+
+	if base, step := splitStep(field); step != "" {
+		if base == "*" {
+			return fmt.Sprintf("every %s", step)
+		}
+		return fmt.Sprintf("every %s from %s", step, describeField(base, names))
+	}
+
+	values := strings.Split(field, ",")
+	for idx, value := range values {
+		if from, to := splitRange(value); to != "" {
+			values[idx] = fmt.Sprintf("%s to %s", name(from, names), name(to, names))
+			continue
+		}
+		values[idx] = name(value, names)
+	}
+
+	if len(values) == 1 {
+		return values[0]
+	}
+	return fmt.Sprintf("%s and %s", strings.Join(values[:len(values)-1], ", "), values[len(values)-1])
+}
+
+func splitStep(field string) (string, string) {
+	parts := strings.SplitN(field, "/", 2)
+	if len(parts) < 2 {
+		return field, ""
+	}
+	return parts[0], parts[1]
+}
+
+func splitRange(field string) (string, string) {
+	parts := strings.SplitN(field, "-", 2)
+	if len(parts) < 2 {
+		return field, ""
+	}
+	return parts[0], parts[1]
+}
+
+func name(value string, names []string) string {
+	idx, err := strconv.Atoi(value)
+	if err != nil || idx < 0 || idx >= len(names) || names[idx] == "" {
+		return value
+	}
+	return names[idx]
+}
+
+func isNumber(value string) bool {
+	_, err := strconv.Atoi(value)
+	return err == nil
+}
+
+func ordinal(n int) string {
+	switch {
+	case n%100 >= 11 && n%100 <= 13:
+		return fmt.Sprintf("%dth", n)
+	case n%10 == 1:
+		return fmt.Sprintf("%dst", n)
+	case n%10 == 2:
+		return fmt.Sprintf("%dnd", n)
+	case n%10 == 3:
+		return fmt.Sprintf("%drd", n)
+	default:
+		return fmt.Sprintf("%dth", n)
+	}
+}
+
 func GetNext(spec string) time.Time {
 	schedule, err := cron.ParseStandard(spec)
 	if err != nil {
@@ -51,3 +371,25 @@ func GetNext(spec string) time.Time {
 	}
 	return schedule.Next(time.Now())
 }
+
+// GetPrevious returns the latest time the spec was due at or before now
+func GetPrevious(spec string, now time.Time) time.Time {
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return time.Time{}
+	}
+
+	// cron can only look forwards, so the window searched is widened until it holds a due time
+	for lookback := 24 * time.Hour; lookback <= maxLookback; lookback *= 2 {
+		var previous time.Time
+		for next := schedule.Next(now.Add(-lookback)); !next.IsZero() && !next.After(now); next = schedule.Next(next) {
+			previous = next
+		}
+
+		if !previous.IsZero() {
+			return previous
+		}
+	}
+
+	return time.Time{}
+}
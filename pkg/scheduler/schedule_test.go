@@ -0,0 +1,268 @@
+package scheduler
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func date(year int, month time.Month, day, hour, min int) time.Time {
+	return time.Date(year, month, day, hour, min, 0, 0, time.Local)
+}
+
+func TestNewSpec(t *testing.T) {
+	tests := []struct {
+		name      string
+		frequency string
+		weekday   time.Weekday
+		day       int
+		custom    string
+		spec      string
+		err       bool
+	}{
+		{name: "weekly", frequency: FrequencyWeekly, weekday: time.Wednesday, spec: "0 0 * * 3"},
+		{name: "weekly on sunday", frequency: FrequencyWeekly, weekday: time.Sunday, spec: "0 0 * * 0"},
+		{name: "weekly with invalid weekday", frequency: FrequencyWeekly, weekday: 7, err: true},
+		{name: "fortnightly", frequency: FrequencyFortnightly, spec: "0 0 1,15 * *"},
+		{name: "monthly", frequency: FrequencyMonthly, day: 22, spec: "0 0 22 * *"},
+		{name: "monthly on last allowed day", frequency: FrequencyMonthly, day: MaxMonthDay, spec: "0 0 28 * *"},
+		{name: "monthly with day after last allowed", frequency: FrequencyMonthly, day: 29, err: true},
+		{name: "monthly with day zero", frequency: FrequencyMonthly, day: 0, err: true},
+		{name: "quarterly", frequency: FrequencyQuarterly, spec: "0 0 1 1/3 *"},
+		{name: "half-yearly", frequency: FrequencyHalfYearly, spec: "0 0 1 1/6 *"},
+		{name: "yearly", frequency: FrequencyYearly, spec: "0 0 1 1/12 *"},
+		{name: "custom", frequency: FrequencyCustom, custom: " 30 8 * * 1-5 ", spec: "30 8 * * 1-5"},
+		{name: "custom descriptor", frequency: FrequencyCustom, custom: "@daily", spec: "@daily"},
+		{name: "custom more than once a day", frequency: FrequencyCustom, custom: "0 * * * *", err: true},
+		{name: "custom that never runs", frequency: FrequencyCustom, custom: "0 0 30 2 *", err: true},
+		{name: "custom that does not parse", frequency: FrequencyCustom, custom: "not a spec", err: true},
+		{name: "unknown frequency", frequency: "daily", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, err := NewSpec(tt.frequency, tt.weekday, tt.day, tt.custom)
+			if tt.err {
+				if !errors.Is(err, ErrInvalidSpec) {
+					t.Fatalf("expected error %v, got spec %q and error %v", ErrInvalidSpec, spec, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if spec != tt.spec {
+				t.Errorf("expected spec %q, got %q", tt.spec, spec)
+			}
+		})
+	}
+}
+
+func TestParseSpec(t *testing.T) {
+	tests := []struct {
+		spec      string
+		frequency string
+		weekday   time.Weekday
+		day       int
+	}{
+		{spec: "0 0 * * 3", frequency: FrequencyWeekly, weekday: time.Wednesday, day: 1},
+		{spec: "0 0 1,15 * *", frequency: FrequencyFortnightly, weekday: time.Monday, day: 1},
+		{spec: "0 0 22 * *", frequency: FrequencyMonthly, weekday: time.Monday, day: 22},
+		{spec: "0 0 1 1/1 *", frequency: FrequencyMonthly, weekday: time.Monday, day: 1},
+		{spec: "0 0 1 1/3 *", frequency: FrequencyQuarterly, weekday: time.Monday, day: 1},
+		{spec: "0 0 1 1/6 *", frequency: FrequencyHalfYearly, weekday: time.Monday, day: 1},
+		{spec: "0 0 1 1/12 *", frequency: FrequencyYearly, weekday: time.Monday, day: 1},
+		{spec: "0 0 31 * *", frequency: FrequencyCustom, weekday: time.Monday, day: 1},
+		{spec: "0 0 1 1/2 *", frequency: FrequencyCustom, weekday: time.Monday, day: 1},
+		{spec: "10 0 1 1/3 *", frequency: FrequencyCustom, weekday: time.Monday, day: 1},
+		{spec: "30 8 * * 1-5", frequency: FrequencyCustom, weekday: time.Monday, day: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			frequency, weekday, day := ParseSpec(tt.spec)
+			if frequency != tt.frequency || weekday != tt.weekday || day != tt.day {
+				t.Errorf("expected (%s, %s, %d), got (%s, %s, %d)", tt.frequency, tt.weekday, tt.day, frequency, weekday, day)
+			}
+		})
+	}
+}
+
+func TestParseSpecReversesNewSpec(t *testing.T) {
+	tests := []struct {
+		frequency string
+		weekday   time.Weekday
+		day       int
+	}{
+		{frequency: FrequencyWeekly, weekday: time.Friday, day: 1},
+		{frequency: FrequencyFortnightly, weekday: time.Monday, day: 1},
+		{frequency: FrequencyMonthly, weekday: time.Monday, day: 15},
+		{frequency: FrequencyQuarterly, weekday: time.Monday, day: 1},
+		{frequency: FrequencyHalfYearly, weekday: time.Monday, day: 1},
+		{frequency: FrequencyYearly, weekday: time.Monday, day: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.frequency, func(t *testing.T) {
+			spec, err := NewSpec(tt.frequency, tt.weekday, tt.day, "")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			frequency, weekday, day := ParseSpec(spec)
+			if frequency != tt.frequency || weekday != tt.weekday || day != tt.day {
+				t.Errorf("expected (%s, %s, %d) from %q, got (%s, %s, %d)", tt.frequency, tt.weekday, tt.day, spec, frequency, weekday, day)
+			}
+		})
+	}
+}
+
+func TestDescribeSpec(t *testing.T) {
+	tests := []struct {
+		spec        string
+		description string
+	}{
+		{spec: "0 0 * * 3", description: "Every Wednesday"},
+		{spec: "0 0 1,15 * *", description: "On the 1st and 15th of every month"},
+		{spec: "0 0 22 * *", description: "On the 22nd of every month"},
+		{spec: "0 0 11 * *", description: "On the 11th of every month"},
+		{spec: "0 0 1 1/3 *", description: "On the 1st of every 3 months"},
+		{spec: "0 0 1 1/6 *", description: "On the 1st of every 6 months"},
+		{spec: "0 0 1 1/12 *", description: "On the 1st of January every year"},
+		{spec: "@daily", description: "Every day"},
+		{spec: "@every 48h", description: "Every 48h"},
+		{spec: "30 8 * * 1-5", description: "At 08:30 on Monday to Friday"},
+		{spec: "0 0 1 6 *", description: "At 00:00 on day 1 of the month in June"},
+		{spec: "0 12 * * 1,3,5", description: "At 12:00 on Monday, Wednesday and Friday"},
+		{spec: "bad", description: `On the schedule "bad"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			if description := DescribeSpec(tt.spec); description != tt.description {
+				t.Errorf("expected %q, got %q", tt.description, description)
+			}
+		})
+	}
+}
+
+func TestSpecToFrequency(t *testing.T) {
+	tests := []struct {
+		spec      string
+		frequency int
+	}{
+		{spec: "0 0 1 1/1 *", frequency: 12},
+		{spec: "0 0 1 1/3 *", frequency: 4},
+		{spec: "0 0 1 1/12 *", frequency: 1},
+		{spec: "0 0 1 1/13 *", frequency: 1},
+		{spec: "0 0 1,15 * *", frequency: 24},
+		{spec: "0 0 15 * *", frequency: 12},
+		{spec: "bad", frequency: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			if frequency := SpecToFrequency(tt.spec); frequency != tt.frequency {
+				t.Errorf("expected %d, got %d", tt.frequency, frequency)
+			}
+		})
+	}
+}
+
+func TestGetPrevious(t *testing.T) {
+	// 23 April 2021 was a Friday
+	now := date(2021, time.April, 23, 12, 0)
+
+	tests := []struct {
+		name     string
+		spec     string
+		now      time.Time
+		previous time.Time
+	}{
+		{name: "earlier in the week", spec: "0 0 * * 3", now: now, previous: date(2021, time.April, 21, 0, 0)},
+		{name: "exactly when due", spec: "0 0 * * 3", now: date(2021, time.April, 21, 0, 0), previous: date(2021, time.April, 21, 0, 0)},
+		{name: "earlier in the month", spec: "0 0 1,15 * *", now: now, previous: date(2021, time.April, 15, 0, 0)},
+		{name: "earlier in the year", spec: "0 0 1 1/12 *", now: now, previous: date(2021, time.January, 1, 0, 0)},
+		{name: "previous year", spec: "0 0 1 6 *", now: now, previous: date(2020, time.June, 1, 0, 0)},
+		{name: "never runs", spec: "0 0 30 2 *", now: now},
+		{name: "invalid", spec: "bad", now: now},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if previous := GetPrevious(tt.spec, tt.now); !previous.Equal(tt.previous) {
+				t.Errorf("expected %v, got %v", tt.previous, previous)
+			}
+		})
+	}
+}
+
+func TestMissedRun(t *testing.T) {
+	now := date(2021, time.April, 23, 12, 0)
+
+	tests := []struct {
+		name        string
+		spec        string
+		since       time.Time
+		maxLateness time.Duration
+		missed      time.Time
+		ok          bool
+	}{
+		{name: "latest of several", spec: "@daily", since: date(2021, time.April, 20, 12, 0), maxLateness: 72 * time.Hour, missed: date(2021, time.April, 23, 0, 0), ok: true},
+		{name: "within lateness", spec: "0 0 * * 3", since: date(2021, time.April, 14, 0, 0), maxLateness: 72 * time.Hour, missed: date(2021, time.April, 21, 0, 0), ok: true},
+		{name: "beyond lateness", spec: "0 0 * * 3", since: date(2021, time.April, 14, 0, 0), maxLateness: 24 * time.Hour},
+		{name: "already ran", spec: "0 0 * * 3", since: date(2021, time.April, 21, 0, 0), maxLateness: 72 * time.Hour},
+		{name: "not yet due", spec: "0 0 * * 3", since: date(2021, time.April, 22, 0, 0), maxLateness: 72 * time.Hour},
+		{name: "invalid", spec: "bad", since: date(2021, time.April, 20, 0, 0), maxLateness: 72 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			missed, ok := MissedRun(tt.spec, tt.since, now, tt.maxLateness)
+			if ok != tt.ok || !missed.Equal(tt.missed) {
+				t.Errorf("expected (%v, %t), got (%v, %t)", tt.missed, tt.ok, missed, ok)
+			}
+		})
+	}
+}
+
+func TestScheduleMissedRun(t *testing.T) {
+	now := date(2021, time.April, 23, 12, 0)
+	created := date(2021, time.April, 1, 0, 0)
+	claimed := date(2021, time.April, 21, 0, 0)
+	succeeded := date(2021, time.April, 14, 0, 0)
+
+	tests := []struct {
+		name     string
+		schedule *Schedule
+		missed   time.Time
+		ok       bool
+	}{
+		{
+			name:     "never run",
+			schedule: &Schedule{Spec: "0 0 * * 3", CreatedAt: created},
+			missed:   date(2021, time.April, 21, 0, 0),
+			ok:       true,
+		},
+		{
+			name:     "succeeded",
+			schedule: &Schedule{Spec: "0 0 * * 3", LastRunAt: &claimed, LastSuccessAt: &claimed, CreatedAt: created},
+		},
+		{
+			name:     "claimed without succeeding",
+			schedule: &Schedule{Spec: "0 0 * * 3", LastRunAt: &claimed, LastSuccessAt: &succeeded, CreatedAt: created},
+			missed:   date(2021, time.April, 21, 0, 0),
+			ok:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			missed, ok := tt.schedule.MissedRun(now, 72*time.Hour)
+			if ok != tt.ok || !missed.Equal(tt.missed) {
+				t.Errorf("expected (%v, %t), got (%v, %t)", tt.missed, tt.ok, missed, ok)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"sync"
 	"time"
 
 	"github.com/go-kit/kit/log"
@@ -22,6 +23,14 @@ type Scheduler struct {
 	logger   log.Logger
 	runner   *cron.Cron
 	database *postgres.Client
+
+	mu   sync.Mutex
+	jobs map[string]*job
+}
+
+type job struct {
+	id   cron.EntryID
+	spec string
 }
 
 func NewScheduler(logger log.Logger, postgres *postgres.Client) *Scheduler {
@@ -29,11 +38,15 @@ func NewScheduler(logger log.Logger, postgres *postgres.Client) *Scheduler {
 		logger:   logger,
 		runner:   cron.New(),
 		database: postgres,
+		jobs:     make(map[string]*job),
 	}
 }
 
+// Run starts the cron runner and blocks until ctx is done, so that leadership can stop it without shutting down
 func (s *Scheduler) Run(ctx context.Context) error {
-	s.runner.Run()
+	s.runner.Start()
+	<-ctx.Done()
+	<-s.runner.Stop().Done()
 	return nil
 }
 
@@ -46,7 +59,7 @@ func (s *Scheduler) List(ctx context.Context) ([]*Schedule, error) {
 	var schedules []*Schedule
 	err := s.database.Transact(ctx, func(tx *sqlx.Tx) error {
 		query := `
-		SELECT id, user_id, spec, created_at
+		SELECT id, user_id, spec, last_run_at, last_success_at, created_at
 		FROM schedules
 		`
 		rows, err := tx.QueryxContext(ctx, query)
@@ -74,7 +87,7 @@ func (s *Scheduler) Get(ctx context.Context, userID string) (*Schedule, error) {
 	var schedule Schedule
 	err := s.database.Transact(ctx, func(tx *sqlx.Tx) error {
 		query := `
-		SELECT id, user_id, spec, created_at
+		SELECT id, user_id, spec, last_run_at, last_success_at, created_at
 		FROM schedules
 		WHERE user_id = $1
 		`
@@ -95,7 +108,7 @@ func (s *Scheduler) Get(ctx context.Context, userID string) (*Schedule, error) {
 
 func (s *Scheduler) Create(ctx context.Context, schedule *Schedule) (cron.EntryID, error) {
 	var err error
-	schedule.ID, err = s.runner.AddFunc(schedule.Spec, schedule.Cmd)
+	schedule.ID, err = s.Set(schedule.UserID, schedule.Spec, schedule.Cmd)
 	if err != nil {
 		return 0, err
 	}
@@ -130,6 +143,104 @@ func (s *Scheduler) Create(ctx context.Context, schedule *Schedule) (cron.EntryI
 	return schedule.ID, nil
 }
 
+// Set registers a job under key, replacing any job whose spec has changed. A job with an unchanged spec is kept
+// as is, so that syncing the same jobs repeatedly never moves their next run.
+func (s *Scheduler) Set(key, spec string, cmd cron.FuncJob) (cron.EntryID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.jobs[key]; ok {
+		if existing.spec == spec {
+			return existing.id, nil
+		}
+		s.runner.Remove(existing.id)
+		delete(s.jobs, key)
+	}
+
+	id, err := s.runner.AddFunc(spec, cmd)
+	if err != nil {
+		return 0, err
+	}
+
+	s.jobs[key] = &job{id: id, spec: spec}
+	return id, nil
+}
+
+func (s *Scheduler) Remove(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.jobs[key]; ok {
+		s.runner.Remove(existing.id)
+		delete(s.jobs, key)
+	}
+}
+
+// Retain removes every job whose key is not in keys
+func (s *Scheduler) Retain(keys map[string]bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, existing := range s.jobs {
+		if !keys[key] {
+			s.runner.Remove(existing.id)
+			delete(s.jobs, key)
+		}
+	}
+}
+
+// ClaimRun records that the run of userID's schedule due at due has been started, reporting false when it, or a
+// later one, has already been claimed
+func (s *Scheduler) ClaimRun(ctx context.Context, userID string, due time.Time) (bool, error) {
+	err := s.database.Transact(ctx, func(tx *sqlx.Tx) error {
+		query := `
+		UPDATE schedules SET
+			last_run_at = $2
+		WHERE user_id = $1 AND (last_run_at IS NULL OR last_run_at < $2)
+		RETURNING user_id
+		`
+		row := tx.QueryRowContext(ctx, query, userID, due)
+		return row.Scan(&userID)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// CompleteRun records that the run of userID's schedule due at due succeeded, so it is not caught up again
+func (s *Scheduler) CompleteRun(ctx context.Context, userID string, due time.Time) error {
+	return s.database.Transact(ctx, func(tx *sqlx.Tx) error {
+		query := `
+		UPDATE schedules SET
+			last_success_at = $2
+		WHERE user_id = $1 AND (last_success_at IS NULL OR last_success_at < $2)
+		`
+		_, err := tx.ExecContext(ctx, query, userID, due)
+		return err
+	})
+}
+
+// ReleaseRun gives up the claim on the run of userID's schedule due at due after it failed, so that it can be
+// caught up later. The claim goes back to the last run that succeeded.
+func (s *Scheduler) ReleaseRun(ctx context.Context, userID string, due time.Time) error {
+	return s.database.Transact(ctx, func(tx *sqlx.Tx) error {
+		query := `
+		UPDATE schedules SET
+			last_run_at = last_success_at
+		WHERE user_id = $1 AND last_run_at = $2
+		`
+		_, err := tx.ExecContext(ctx, query, userID, due)
+		return err
+	})
+}
+
 func (s *Scheduler) Delete(ctx context.Context, userID string) error {
 	var id cron.EntryID
 	err := s.database.Transact(ctx, func(tx *sqlx.Tx) error {
@@ -150,7 +261,8 @@ func (s *Scheduler) Delete(ctx context.Context, userID string) error {
 		}
 	}
 
-	s.runner.Remove(id)
+	// the stored entry ID belongs to whichever instance created the schedule, so the local job is removed by user
+	s.Remove(userID)
 	return nil
 }
 
@@ -2,13 +2,17 @@ package spautofy
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 	"path"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 
 	"github.com/jace-ys/spautofy/pkg/accounts"
+	"github.com/jace-ys/spautofy/pkg/playlists"
 	"github.com/jace-ys/spautofy/pkg/scheduler"
 )
 
@@ -17,8 +21,14 @@ func (h *Handler) updateAccount() http.HandlerFunc {
 		account, err := h.parseAccountForm(r)
 		if err != nil {
 			h.logger.Log("event", "form.parse.failed", "error", err)
-			h.renderError(http.StatusInternalServerError).ServeHTTP(w, r)
-			return
+			switch {
+			case errors.Is(err, errInvalidForm):
+				h.renderError(http.StatusBadRequest).ServeHTTP(w, r)
+				return
+			default:
+				h.renderError(http.StatusInternalServerError).ServeHTTP(w, r)
+				return
+			}
 		}
 
 		userID, err := h.accounts.CreateOrUpdate(r.Context(), account)
@@ -40,52 +50,195 @@ func (h *Handler) updateAccount() http.HandlerFunc {
 			}
 		}
 
-		builder, err := h.builder.NewBuilder(r.Context(), h.logger, userID)
+		cmd := h.runSchedule(userID)
+
+		schedule := scheduler.NewSchedule(userID, account.Schedule, cmd)
+		scheduleID, err := h.scheduler.Create(r.Context(), schedule)
 		if err != nil {
-			h.logger.Log("event", "builder.new.failed", "error", err)
+			h.logger.Log("event", "schedule.create.failed", "error", err)
 			h.renderError(http.StatusInternalServerError).ServeHTTP(w, r)
 			return
 		}
 
-		cmd := builder.Run(account.TrackLimit, account.WithConfirm)
-
-		schedule := scheduler.NewSchedule(userID, account.Schedule, cmd)
-		scheduleID, err := h.scheduler.Create(r.Context(), schedule)
+		user, err := h.users.Get(r.Context(), userID)
 		if err != nil {
-			h.logger.Log("event", "schedule.create.failed", "error", err)
+			h.logger.Log("event", "user.get.failed", "error", err)
 			h.renderError(http.StatusInternalServerError).ServeHTTP(w, r)
 			return
 		}
 
-		w.Header().Set("Location", path.Join("/accounts", userID))
+		location := path.Join("/accounts", userID)
+		if !user.HasScopes(playlists.VisibilityScopes(account.Visibility)...) {
+			location = consentURL(account.Visibility)
+		}
+
+		w.Header().Set("Location", location)
 		w.WriteHeader(http.StatusFound)
 
 		h.logger.Log("event", "account.updated", "user", userID, "schedule", scheduleID)
 	}
 }
 
+var (
+	errInvalidForm = errors.New("invalid form")
+)
+
+const (
+	previewTopArtist = "Your Top Artist"
+	previewFirstName = "Spautofy"
+)
+
+func newPreviewData(schedule string, trackLimit int, firstName string) *playlists.TemplateData {
+	return playlists.NewTemplateData(time.Now(), scheduler.SpecToDescription(schedule), trackLimit, previewTopArtist, firstName)
+}
+
 func (h *Handler) parseAccountForm(r *http.Request) (*accounts.Account, error) {
 	err := r.ParseForm()
 	if err != nil {
 		return nil, err
 	}
 
-	frequency, err := strconv.Atoi(r.PostForm.Get("frequency"))
+	schedule, err := parseScheduleForm(r)
 	if err != nil {
 		return nil, err
 	}
 
 	limit, err := strconv.Atoi(r.PostForm.Get("limit"))
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: invalid limit: %s", errInvalidForm, err)
+	}
+
+	if limit < 1 || limit > playlists.MaxTrackLimit {
+		return nil, fmt.Errorf("%w: invalid limit: %d", errInvalidForm, limit)
+	}
+
+	timerange := r.PostForm.Get("timerange")
+	switch timerange {
+	case "":
+		timerange = playlists.DefaultTimerange(scheduler.SpecToFrequency(schedule))
+	case playlists.TimerangeShort, playlists.TimerangeMedium, playlists.TimerangeLong:
+		// no-op
+	default:
+		return nil, fmt.Errorf("%w: invalid timerange: %s", errInvalidForm, timerange)
+	}
+
+	discoveryRatio, err := strconv.Atoi(r.PostForm.Get("discovery"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid discovery ratio: %s", errInvalidForm, err)
+	}
+
+	if discoveryRatio < 0 || discoveryRatio > 100 {
+		return nil, fmt.Errorf("%w: invalid discovery ratio: %d", errInvalidForm, discoveryRatio)
 	}
 
+	freshness, err := strconv.Atoi(r.PostForm.Get("freshness"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid freshness: %s", errInvalidForm, err)
+	}
+
+	if freshness < 0 {
+		return nil, fmt.Errorf("%w: invalid freshness: %d", errInvalidForm, freshness)
+	}
+
+	mode := r.PostForm.Get("mode")
+	switch mode {
+	case playlists.ModeNew, playlists.ModeRolling:
+		// no-op
+	default:
+		return nil, fmt.Errorf("%w: invalid mode: %s", errInvalidForm, mode)
+	}
+
+	visibility := r.PostForm.Get("visibility")
+	switch visibility {
+	case playlists.VisibilityPrivate, playlists.VisibilityPublic, playlists.VisibilityCollaborative:
+		// no-op
+	default:
+		return nil, fmt.Errorf("%w: invalid visibility: %s", errInvalidForm, visibility)
+	}
+
+	ordering := r.PostForm.Get("ordering")
+	switch ordering {
+	case playlists.OrderingRank, playlists.OrderingEnergy, playlists.OrderingTempo, playlists.OrderingHarmonic:
+		// no-op
+	default:
+		return nil, fmt.Errorf("%w: invalid ordering: %s", errInvalidForm, ordering)
+	}
+
+	source := r.PostForm.Get("source")
+	switch source {
+	case playlists.SourceTopTracks, playlists.SourceArtistTopTracks, playlists.SourceArtistReleases:
+		// no-op
+	default:
+		return nil, fmt.Errorf("%w: invalid source: %s", errInvalidForm, source)
+	}
+
+	artistTrackLimit, err := strconv.Atoi(r.PostForm.Get("artist-limit"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid tracks per artist: %s", errInvalidForm, err)
+	}
+
+	if artistTrackLimit < 1 {
+		return nil, fmt.Errorf("%w: invalid tracks per artist: %d", errInvalidForm, artistTrackLimit)
+	}
+
+	genreInclude := playlists.ParseGenres(r.PostForm.Get("genres-include"))
+	genreExclude := playlists.ParseGenres(r.PostForm.Get("genres-exclude"))
+
+	nameTemplate := strings.TrimSpace(r.PostForm.Get("name"))
+	descriptionTemplate := strings.TrimSpace(r.PostForm.Get("description"))
+
+	_, _, err = newPreviewData(schedule, limit, previewFirstName).RenderNameAndDescription(nameTemplate, descriptionTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid templates: %s", errInvalidForm, err)
+	}
+
+	_, withCover := r.PostForm["cover"]
+	_, withoutExplicit := r.PostForm["clean"]
+	_, withWrapped := r.PostForm["wrapped"]
 	_, withConfirm := r.PostForm["confirm"]
 
-	account := accounts.NewAccount(mux.Vars(r)["userID"], scheduler.FrequencyToSpec(frequency), limit, withConfirm)
+	account := accounts.NewAccount(mux.Vars(r)["userID"], schedule, limit, timerange, withConfirm)
+	account.DiscoveryRatio = discoveryRatio
+	account.Freshness = freshness
+	account.NameTemplate = nameTemplate
+	account.DescriptionTemplate = descriptionTemplate
+	account.Mode = mode
+	account.Visibility = visibility
+	account.Ordering = ordering
+	account.Source = source
+	account.ArtistTrackLimit = artistTrackLimit
+	account.GenreInclude = genreInclude
+	account.GenreExclude = genreExclude
+	account.WithCover = withCover
+	account.WithoutExplicit = withoutExplicit
+	account.WithWrapped = withWrapped
+
 	return account, nil
 }
 
+func parseScheduleForm(r *http.Request) (string, error) {
+	frequency := r.PostForm.Get("frequency")
+
+	var weekday, day int
+	var err error
+	switch frequency {
+	case scheduler.FrequencyWeekly:
+		weekday, err = strconv.Atoi(r.PostForm.Get("weekday"))
+	case scheduler.FrequencyMonthly:
+		day, err = strconv.Atoi(r.PostForm.Get("day"))
+	}
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid schedule: %s", errInvalidForm, err)
+	}
+
+	schedule, err := scheduler.NewSpec(frequency, time.Weekday(weekday), day, r.PostForm.Get("spec"))
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid schedule: %s", errInvalidForm, err)
+	}
+
+	return schedule, nil
+}
+
 func (h *Handler) deleteAccount() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID := mux.Vars(r)["userID"]
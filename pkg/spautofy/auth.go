@@ -3,18 +3,24 @@ package spautofy
 import (
 	"context"
 	"encoding/gob"
+	"errors"
 	"net/http"
+	"net/url"
 	"path"
 
 	"github.com/gorilla/mux"
 	"github.com/zmb3/spotify"
 
+	"github.com/jace-ys/spautofy/pkg/accounts"
+	"github.com/jace-ys/spautofy/pkg/playlists"
+	"github.com/jace-ys/spautofy/pkg/spotifyhttp"
 	"github.com/jace-ys/spautofy/pkg/users"
 )
 
 func init() {
 	gob.Register(userIDKey{})
 	gob.Register(requestPathKey{})
+	gob.Register(consentKey{})
 }
 
 var (
@@ -22,6 +28,7 @@ var (
 		spotify.ScopeUserReadEmail,
 		spotify.ScopeUserTopRead,
 		spotify.ScopePlaylistModifyPrivate,
+		spotify.ScopeImageUpload,
 	}
 )
 
@@ -29,6 +36,25 @@ type userIDKey struct{}
 
 type requestPathKey struct{}
 
+type consentKey struct{}
+
+func newAuthenticator(redirectURL string, cfg *SpotifyConfig, visibility string) *spotify.Authenticator {
+	extra := playlists.VisibilityScopes(visibility)
+
+	s := make([]string, 0, len(scopes)+len(extra))
+	s = append(s, scopes...)
+	s = append(s, extra...)
+
+	authenticator := spotify.NewAuthenticator(redirectURL, s...)
+	authenticator.SetAuthInfo(cfg.ClientID, cfg.ClientSecret)
+
+	return &authenticator
+}
+
+func consentURL(visibility string) string {
+	return "/login?" + url.Values{"visibility": {visibility}}.Encode()
+}
+
 func (h *Handler) loginRedirect() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		h.logger.Log("event", "login.started")
@@ -49,7 +75,25 @@ func (h *Handler) loginRedirect() http.HandlerFunc {
 			}
 		}
 
-		http.Redirect(w, r, h.authenticator.AuthURL(session.GetID()), http.StatusFound)
+		authenticator := h.authenticator
+
+		// request the additional scopes needed for the chosen playlist visibility
+		visibility := r.URL.Query().Get("visibility")
+		if consentAuthenticator, ok := h.consentAuthenticators[visibility]; ok {
+			authenticator = consentAuthenticator
+
+			values := make(map[interface{}]interface{})
+			values[consentKey{}] = visibility
+
+			session, err = h.sessions.Update(w, r, values)
+			if err != nil {
+				h.logger.Log("event", "login.failed", "error", err)
+				h.renderError(http.StatusInternalServerError).ServeHTTP(w, r)
+				return
+			}
+		}
+
+		http.Redirect(w, r, authenticator.AuthURL(session.GetID()), http.StatusFound)
 	}
 }
 
@@ -69,7 +113,7 @@ func (h *Handler) loginCallback() http.HandlerFunc {
 			return
 		}
 
-		client := h.authenticator.NewClient(token)
+		client := spotifyhttp.NewClient(h.authenticator, token, h.transport)
 		spotifyUser, err := client.CurrentUser()
 		if err != nil {
 			h.logger.Log("event", "login.failed", "error", err)
@@ -85,8 +129,11 @@ func (h *Handler) loginCallback() http.HandlerFunc {
 			return
 		}
 
+		requested, _ := session.Values[consentKey{}].(string)
+
 		values := make(map[interface{}]interface{})
 		values[userIDKey{}] = userID
+		values[consentKey{}] = ""
 
 		session, err = h.sessions.Update(w, r, values)
 		if err != nil {
@@ -103,6 +150,21 @@ func (h *Handler) loginCallback() http.HandlerFunc {
 			location = path.Join("/accounts", spotifyUser.ID)
 		}
 
+		account, err := h.accounts.Get(r.Context(), userID)
+		if err != nil {
+			switch {
+			case errors.Is(err, accounts.ErrAccountNotFound):
+				// no-op
+			default:
+				h.logger.Log("event", "account.get.failed", "error", err)
+				h.renderError(http.StatusInternalServerError).ServeHTTP(w, r)
+				return
+			}
+		} else if account.Visibility != requested && !user.HasScopes(playlists.VisibilityScopes(account.Visibility)...) {
+			// a regular login only requests the base scopes, so ask again for those the account needs
+			location = consentURL(account.Visibility)
+		}
+
 		w.Header().Set("Location", location)
 		w.WriteHeader(http.StatusFound)
 
@@ -0,0 +1,140 @@
+package spautofy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/zmb3/spotify"
+
+	"github.com/jace-ys/spautofy/pkg/playlists"
+)
+
+const (
+	exportPageSize = 50
+)
+
+func (h *Handler) exportPlaylist() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := exportFormat(r)
+		contentType, err := playlists.ContentType(format)
+		if err != nil {
+			h.renderError(http.StatusBadRequest).ServeHTTP(w, r)
+			return
+		}
+
+		userID := mux.Vars(r)["userID"]
+		playlistID := mux.Vars(r)["playlistID"]
+
+		playlist, err := h.playlists.Get(r.Context(), userID, playlistID)
+		if err != nil {
+			switch {
+			case errors.Is(err, playlists.ErrPlaylistNotFound):
+				h.renderError(http.StatusNotFound).ServeHTTP(w, r)
+				return
+			default:
+				h.logger.Log("event", "playlist.get.failed", "error", err)
+				h.renderError(http.StatusInternalServerError).ServeHTTP(w, r)
+				return
+			}
+		}
+
+		tracks, err := h.builder.FetchTracks(r.Context(), h.logger, userID, playlist.TrackIDs)
+		if err != nil {
+			h.logger.Log("event", "tracks.fetch.failed", "error", err)
+			h.renderError(http.StatusInternalServerError).ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", playlists.ExportFilename(playlist, format)))
+
+		err = playlists.Export(w, format, playlist, tracks)
+		if err != nil {
+			h.logger.Log("event", "playlist.export.failed", "error", err)
+			return
+		}
+
+		h.logger.Log("event", "playlist.exported", "user", userID, "playlist", playlist.ID, "format", format)
+	}
+}
+
+func (h *Handler) exportPlaylists() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := exportFormat(r)
+		if _, err := playlists.ContentType(format); err != nil {
+			h.renderError(http.StatusBadRequest).ServeHTTP(w, r)
+			return
+		}
+
+		userID := mux.Vars(r)["userID"]
+
+		var history []*playlists.Playlist
+		for offset := 0; ; offset += exportPageSize {
+			page, err := h.playlists.List(r.Context(), userID, exportPageSize, offset)
+			if err != nil {
+				h.logger.Log("event", "playlists.list.failed", "error", err)
+				h.renderError(http.StatusInternalServerError).ServeHTTP(w, r)
+				return
+			}
+
+			history = append(history, page...)
+			if len(page) < exportPageSize {
+				break
+			}
+		}
+
+		// tracks often repeat across playlists, so each one is only fetched once
+		seen := make(map[spotify.ID]bool)
+		var trackIDs []spotify.ID
+		for _, playlist := range history {
+			for _, id := range playlist.TrackIDs {
+				if !seen[id] {
+					seen[id] = true
+					trackIDs = append(trackIDs, id)
+				}
+			}
+		}
+
+		fetched, err := h.builder.FetchTracks(r.Context(), h.logger, userID, trackIDs)
+		if err != nil {
+			h.logger.Log("event", "tracks.fetch.failed", "error", err)
+			h.renderError(http.StatusInternalServerError).ServeHTTP(w, r)
+			return
+		}
+
+		byID := make(map[spotify.ID]*playlists.Track, len(fetched))
+		for _, track := range fetched {
+			byID[track.ID] = track
+		}
+
+		tracks := make(map[string][]*playlists.Track, len(history))
+		for _, playlist := range history {
+			for _, id := range playlist.TrackIDs {
+				if track, ok := byID[id]; ok {
+					tracks[playlist.ID] = append(tracks[playlist.ID], track)
+				}
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("spautofy-%s.zip", format)))
+
+		err = playlists.ExportArchive(w, format, history, tracks)
+		if err != nil {
+			h.logger.Log("event", "playlists.export.failed", "error", err)
+			return
+		}
+
+		h.logger.Log("event", "playlists.exported", "user", userID, "count", len(history), "format", format)
+	}
+}
+
+func exportFormat(r *http.Request) string {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		return playlists.FormatJSON
+	}
+	return format
+}
@@ -0,0 +1,243 @@
+package spautofy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/jace-ys/spautofy/pkg/groups"
+	"github.com/jace-ys/spautofy/pkg/playlists"
+	"github.com/jace-ys/spautofy/pkg/scheduler"
+)
+
+const (
+	groupFrequency = 12
+)
+
+func (h *Handler) renderGroups() http.HandlerFunc {
+	type groupData struct {
+		ID         string
+		Name       string
+		IsOwner    bool
+		Members    int
+		TrackLimit int
+		InviteLink string
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := struct {
+			UserID     string
+			ConsentURL string
+			Groups     []*groupData
+		}{}
+
+		userID := mux.Vars(r)["userID"]
+
+		list, err := h.groups.ListForUser(r.Context(), userID)
+		if err != nil {
+			h.logger.Log("event", "groups.list.failed", "error", err)
+			h.renderError(http.StatusInternalServerError).ServeHTTP(w, r)
+			return
+		}
+
+		for _, group := range list {
+			members, err := h.groups.ListMembers(r.Context(), group.ID)
+			if err != nil {
+				h.logger.Log("event", "members.list.failed", "error", err)
+				h.renderError(http.StatusInternalServerError).ServeHTTP(w, r)
+				return
+			}
+
+			inviteURL := *h.baseURL
+			inviteURL.Path = path.Join(inviteURL.Path, "groups", "join", group.InviteCode)
+
+			data.Groups = append(data.Groups, &groupData{
+				ID:         group.ID,
+				Name:       group.Name,
+				IsOwner:    group.OwnerID == userID,
+				Members:    len(members),
+				TrackLimit: group.TrackLimit,
+				InviteLink: inviteURL.String(),
+			})
+		}
+
+		user, err := h.users.Get(r.Context(), userID)
+		if err != nil {
+			h.logger.Log("event", "user.get.failed", "error", err)
+			h.renderError(http.StatusInternalServerError).ServeHTTP(w, r)
+			return
+		}
+
+		// group playlists are only built once their owner has allowed public playlists
+		for _, group := range data.Groups {
+			if group.IsOwner && !user.HasScopes(playlists.VisibilityScopes(playlists.VisibilityPublic)...) {
+				data.ConsentURL = consentURL(playlists.VisibilityPublic)
+				break
+			}
+		}
+
+		data.UserID = userID
+
+		h.logger.Log("event", "template.rendered", "template", "groups", "user", userID)
+		tmpls.ExecuteTemplate(w, "groups", data)
+	}
+}
+
+func (h *Handler) createGroup() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		group, err := h.parseGroupForm(r)
+		if err != nil {
+			h.logger.Log("event", "form.parse.failed", "error", err)
+			switch {
+			case errors.Is(err, errInvalidForm):
+				h.renderError(http.StatusBadRequest).ServeHTTP(w, r)
+				return
+			default:
+				h.renderError(http.StatusInternalServerError).ServeHTTP(w, r)
+				return
+			}
+		}
+
+		groupID, err := h.groups.Create(r.Context(), group)
+		if err != nil {
+			h.logger.Log("event", "group.create.failed", "error", err)
+			h.renderError(http.StatusInternalServerError).ServeHTTP(w, r)
+			return
+		}
+
+		_, err = h.scheduler.Set(groupJobKey(groupID), group.Schedule, h.runGroup(groupID))
+		if err != nil {
+			h.logger.Log("event", "schedule.create.failed", "error", err)
+			h.renderError(http.StatusInternalServerError).ServeHTTP(w, r)
+			return
+		}
+
+		user, err := h.users.Get(r.Context(), group.OwnerID)
+		if err != nil {
+			h.logger.Log("event", "user.get.failed", "error", err)
+			h.renderError(http.StatusInternalServerError).ServeHTTP(w, r)
+			return
+		}
+
+		// members can only open the group playlist when it is public
+		location := path.Join("/accounts", group.OwnerID, "groups")
+		if !user.HasScopes(playlists.VisibilityScopes(playlists.VisibilityPublic)...) {
+			location = consentURL(playlists.VisibilityPublic)
+		}
+
+		w.Header().Set("Location", location)
+		w.WriteHeader(http.StatusFound)
+
+		h.logger.Log("event", "group.created", "user", group.OwnerID, "group", groupID)
+	}
+}
+
+func (h *Handler) parseGroupForm(r *http.Request) (*groups.Group, error) {
+	err := r.ParseForm()
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSpace(r.PostForm.Get("name"))
+	if name == "" {
+		return nil, fmt.Errorf("%w: missing group name", errInvalidForm)
+	}
+
+	limit, err := strconv.Atoi(r.PostForm.Get("limit"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid limit: %s", errInvalidForm, err)
+	}
+
+	if limit < 1 || limit > playlists.MaxTrackLimit {
+		return nil, fmt.Errorf("%w: invalid limit: %d", errInvalidForm, limit)
+	}
+
+	return groups.NewGroup(mux.Vars(r)["userID"], name, scheduler.FrequencyToSpec(groupFrequency), limit)
+}
+
+func (h *Handler) joinGroup() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(userIDKey{}).(string)
+		if !ok {
+			h.renderError(http.StatusUnauthorized).ServeHTTP(w, r)
+			return
+		}
+
+		group, err := h.groups.GetByInviteCode(r.Context(), mux.Vars(r)["inviteCode"])
+		if err != nil {
+			switch {
+			case errors.Is(err, groups.ErrGroupNotFound):
+				h.renderError(http.StatusNotFound).ServeHTTP(w, r)
+				return
+			default:
+				h.logger.Log("event", "group.get.failed", "error", err)
+				h.renderError(http.StatusInternalServerError).ServeHTTP(w, r)
+				return
+			}
+		}
+
+		err = h.groups.AddMember(r.Context(), group.ID, userID)
+		if err != nil {
+			h.logger.Log("event", "member.add.failed", "error", err)
+			h.renderError(http.StatusInternalServerError).ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Location", path.Join("/accounts", userID, "groups"))
+		w.WriteHeader(http.StatusFound)
+
+		h.logger.Log("event", "group.joined", "user", userID, "group", group.ID)
+	}
+}
+
+func (h *Handler) leaveGroup() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := mux.Vars(r)["userID"]
+		groupID := mux.Vars(r)["groupID"]
+
+		group, err := h.groups.Get(r.Context(), groupID)
+		if err != nil {
+			switch {
+			case errors.Is(err, groups.ErrGroupNotFound):
+				h.renderError(http.StatusNotFound).ServeHTTP(w, r)
+				return
+			default:
+				h.logger.Log("event", "group.get.failed", "error", err)
+				h.renderError(http.StatusInternalServerError).ServeHTTP(w, r)
+				return
+			}
+		}
+
+		// the group playlist lives in the owner's account, so the group cannot outlive them
+		if group.OwnerID == userID {
+			err = h.groups.Delete(r.Context(), group.ID)
+		} else {
+			err = h.groups.RemoveMember(r.Context(), group.ID, userID)
+		}
+		if err != nil {
+			switch {
+			case errors.Is(err, groups.ErrGroupNotFound), errors.Is(err, groups.ErrMemberNotFound):
+				h.renderError(http.StatusNotFound).ServeHTTP(w, r)
+				return
+			default:
+				h.logger.Log("event", "group.leave.failed", "error", err)
+				h.renderError(http.StatusInternalServerError).ServeHTTP(w, r)
+				return
+			}
+		}
+
+		if group.OwnerID == userID {
+			h.scheduler.Remove(groupJobKey(group.ID))
+		}
+
+		w.Header().Set("Location", path.Join("/accounts", userID, "groups"))
+		w.WriteHeader(http.StatusFound)
+
+		h.logger.Log("event", "group.left", "user", userID, "group", group.ID)
+	}
+}
@@ -4,10 +4,12 @@ import (
 	"context"
 	"embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"path"
+	"strings"
 	"time"
 
 	"github.com/etherlabsio/healthcheck"
@@ -18,10 +20,12 @@ import (
 
 	"github.com/jace-ys/go-library/postgres"
 	"github.com/jace-ys/spautofy/pkg/accounts"
+	"github.com/jace-ys/spautofy/pkg/groups"
 	"github.com/jace-ys/spautofy/pkg/mail"
 	"github.com/jace-ys/spautofy/pkg/playlists"
 	"github.com/jace-ys/spautofy/pkg/scheduler"
 	"github.com/jace-ys/spautofy/pkg/sessions"
+	"github.com/jace-ys/spautofy/pkg/spotifyhttp"
 	"github.com/jace-ys/spautofy/pkg/users"
 )
 
@@ -31,52 +35,79 @@ var staticFS embed.FS
 type Config struct {
 	BaseURL         *url.URL
 	SessionStoreKey string
+	MaxLateness     time.Duration
 	Spotify         SpotifyConfig
 	SendGrid        mail.SendGridConfig
+
+	// Mailer sends emails in place of SendGrid when set, such as in tests
+	Mailer mail.Mailer
 }
 
 type SpotifyConfig struct {
 	ClientID     string
 	ClientSecret string
+
+	// Transport carries requests to Spotify in place of the default transport when set, such as to reach a fake API
+	Transport http.RoundTripper
 }
 
 type Handler struct {
 	logger        log.Logger
+	baseURL       *url.URL
 	server        *http.Server
 	metrics       *http.Server
 	database      *postgres.Client
 	users         *users.Registry
 	accounts      *accounts.Registry
+	groups        *groups.Registry
 	scheduler     *scheduler.Scheduler
+	elector       *scheduler.Elector
+	maxLateness   time.Duration
 	playlists     *playlists.Registry
+	tracks        *playlists.TrackRegistry
 	builder       *playlists.BuilderFactory
 	authenticator *spotify.Authenticator
+	appClient     *spotify.Client
+	transport     http.RoundTripper
 	sessions      *sessions.Manager
+
+	consentAuthenticators map[string]*spotify.Authenticator
 }
 
 func NewHandler(logger log.Logger, cfg *Config, postgres *postgres.Client) *Handler {
 	redirectURL := *cfg.BaseURL
 	redirectURL.Path = path.Join(redirectURL.Path, "login/callback")
-	authenticator := spotify.NewAuthenticator(redirectURL.String(), scopes...)
-	authenticator.SetAuthInfo(cfg.Spotify.ClientID, cfg.Spotify.ClientSecret)
 
 	handler := &Handler{
 		logger:        logger,
+		baseURL:       cfg.BaseURL,
 		server:        &http.Server{},
 		metrics:       &http.Server{},
 		database:      postgres,
 		users:         users.NewRegistry(postgres),
 		accounts:      accounts.NewRegistry(postgres),
+		groups:        groups.NewRegistry(postgres),
 		scheduler:     scheduler.NewScheduler(logger, postgres),
+		elector:       scheduler.NewElector(logger, postgres, "scheduler"),
+		maxLateness:   cfg.MaxLateness,
 		playlists:     playlists.NewRegistry(postgres),
-		authenticator: &authenticator,
+		tracks:        playlists.NewTrackRegistry(postgres),
+		authenticator: newAuthenticator(redirectURL.String(), &cfg.Spotify, playlists.VisibilityPrivate),
+		transport:     spotifyhttp.NewTransport(cfg.Spotify.Transport),
 		sessions:      sessions.NewManager("spautofy_session", cfg.SessionStoreKey, time.Hour),
+		consentAuthenticators: map[string]*spotify.Authenticator{
+			playlists.VisibilityPublic: newAuthenticator(redirectURL.String(), &cfg.Spotify, playlists.VisibilityPublic),
+		},
 	}
 
 	handler.server.Handler = handler.router()
+	handler.appClient = spotifyhttp.NewAppClient(cfg.Spotify.ClientID, cfg.Spotify.ClientSecret, handler.transport)
 
-	mailer := mail.NewSendGridMailer(&cfg.SendGrid)
-	handler.builder = playlists.NewBuilderFactory(cfg.BaseURL, mailer, handler.playlists, handler.users, handler.authenticator)
+	mailer := cfg.Mailer
+	if mailer == nil {
+		mailer = mail.NewSendGridMailer(&cfg.SendGrid)
+	}
+	handler.builder = playlists.NewBuilderFactory(cfg.BaseURL, mailer, handler.playlists, handler.tracks, handler.users, handler.authenticator, handler.transport)
 
 	return handler
 }
@@ -96,10 +127,22 @@ func (h *Handler) router() http.Handler {
 	accounts.HandleFunc("", h.renderAccount()).Methods(http.MethodGet)
 	accounts.HandleFunc("", h.updateAccount()).Methods(http.MethodPost)
 	accounts.HandleFunc("/unsubscribe", h.deleteAccount()).Methods(http.MethodGet)
+	accounts.HandleFunc("/playlists", h.renderPlaylists()).Methods(http.MethodGet)
+	accounts.HandleFunc("/playlists/export", h.exportPlaylists()).Methods(http.MethodGet)
+	accounts.HandleFunc("/groups", h.renderGroups()).Methods(http.MethodGet)
+	accounts.HandleFunc("/groups", h.createGroup()).Methods(http.MethodPost)
+	accounts.HandleFunc("/groups/{groupID}/leave", h.leaveGroup()).Methods(http.MethodPost)
 
-	playlists := accounts.PathPrefix("/playlists/{playlistName}").Subrouter()
+	playlists := accounts.PathPrefix("/playlists/{playlistID}").Subrouter()
 	playlists.HandleFunc("", h.renderPlaylist()).Methods(http.MethodGet)
 	playlists.HandleFunc("", h.createPlaylist()).Methods(http.MethodPost)
+	playlists.HandleFunc("/history", h.renderPlaylistHistory()).Methods(http.MethodGet)
+	playlists.HandleFunc("/export", h.exportPlaylist()).Methods(http.MethodGet)
+	playlists.HandleFunc("/history/{versionID}", h.renderPlaylistVersion()).Methods(http.MethodGet)
+
+	invites := router.PathPrefix("/groups").Subrouter()
+	invites.Use(h.middlewareAuthenticate)
+	invites.HandleFunc("/join/{inviteCode}", h.joinGroup()).Methods(http.MethodGet)
 
 	router.NotFoundHandler = http.HandlerFunc(h.renderError(http.StatusNotFound))
 
@@ -134,6 +177,10 @@ func (h *Handler) StartMetricsServer(port int) error {
 				},
 			),
 		),
+		// followers are healthy too, so leadership is only reported rather than failing the check
+		healthcheck.WithObserver(
+			"leader", healthcheck.CheckerFunc(h.elector.Check),
+		),
 	))
 
 	router.HandleFunc("/crons", func(w http.ResponseWriter, r *http.Request) {
@@ -148,6 +195,24 @@ func (h *Handler) StartMetricsServer(port int) error {
 		w.Write(data)
 	})
 
+	router.HandleFunc("/runs", func(w http.ResponseWriter, r *http.Request) {
+		runs, err := h.scheduler.ListRecentRuns(r.Context(), recentRunsLimit)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		data, err := json.Marshal(runs)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		w.Write(data)
+	})
+
 	h.metrics.Handler = router
 	h.metrics.Addr = fmt.Sprintf(":%d", port)
 
@@ -158,17 +223,35 @@ func (h *Handler) StartMetricsServer(port int) error {
 	return nil
 }
 
+const (
+	recentRunsLimit      = 100
+	scheduleSyncInterval = time.Minute
+	staleRunTimeout      = time.Hour
+	wrappedJobKey        = "wrapped"
+	groupJobPrefix       = "group:"
+)
+
 func (h *Handler) StartRunner(ctx context.Context) error {
 	h.logger.Log("event", "scheduler.started")
 	defer h.logger.Log("event", "scheduler.stopped")
 
-	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	if err := h.elector.Run(ctx, h.lead); err != nil {
+		return fmt.Errorf("failed to start scheduler: %w", err)
+	}
+
+	return nil
+}
+
+// lead runs the scheduler and the track refresher for as long as this instance holds the lease. Schedules can be
+// changed through any instance, so the leader keeps syncing them from the database.
+func (h *Handler) lead(ctx context.Context) error {
+	loadCtx, cancel := context.WithTimeout(ctx, time.Minute)
 	defer cancel()
 
 	var count int
 	var err error
 	for {
-		count, err = h.loadSchedules(ctx)
+		count, err = h.syncSchedules(loadCtx)
 		if err == nil {
 			break
 		}
@@ -177,52 +260,415 @@ func (h *Handler) StartRunner(ctx context.Context) error {
 		select {
 		case <-time.After(15 * time.Second):
 			continue
-		case <-ctx.Done():
-			err = fmt.Errorf("%s: %w", ctx.Err(), err)
+		case <-loadCtx.Done():
+			err = fmt.Errorf("%s: %w", loadCtx.Err(), err)
 			return fmt.Errorf("failed to load schedules: %w", err)
 		}
 	}
 
 	h.logger.Log("event", "schedules.loaded", "loaded", count)
 
-	if err := h.scheduler.Run(ctx); err != nil {
-		return fmt.Errorf("failed to start scheduler: %w", err)
-	}
+	go h.catchUp(ctx)
+	go h.refreshTracks(ctx)
+
+	go func() {
+		ticker := time.NewTicker(scheduleSyncInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := h.syncSchedules(ctx); err != nil {
+					h.logger.Log("event", "schedules.sync.failed", "error", err)
+				}
+
+				// only the leader runs jobs, so anything still running well past how long a build takes was
+				// left behind by an instance that stopped part way through
+				stale, err := h.scheduler.FailStaleRuns(ctx, staleRunTimeout)
+				if err != nil {
+					h.logger.Log("event", "runs.resolve.failed", "error", err)
+					continue
+				}
+				if len(stale) == 0 {
+					continue
+				}
+
+				for _, run := range stale {
+					// runs recorded before due times were kept have no claim to give up
+					if run.DueAt == nil {
+						continue
+					}
+					if err := h.settleClaim(ctx, run.Job, run.UserID, *run.DueAt, false); err != nil {
+						h.logger.Log("event", "run.release.failed", "job", run.Job, "run", run.ID, "error", err)
+					}
+				}
+
+				h.logger.Log("event", "runs.resolved", "failed", len(stale))
+
+				// the interrupted runs can be caught up now that their claims have been given up
+				go h.catchUp(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
 
-	return nil
+	return h.scheduler.Run(ctx)
 }
 
-func (h *Handler) loadSchedules(ctx context.Context) (int, error) {
+func (h *Handler) syncSchedules(ctx context.Context) (int, error) {
 	schedules, err := h.scheduler.List(ctx)
 	if err != nil {
 		return 0, err
 	}
 
-	var loaded int
-	for idx, schedule := range schedules {
-		account, err := h.accounts.Get(ctx, schedule.UserID)
+	list, err := h.groups.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	keys := make(map[string]bool)
+	for _, schedule := range schedules {
+		_, err := h.scheduler.Set(schedule.UserID, schedule.Spec, h.runSchedule(schedule.UserID))
 		if err != nil {
-			return idx, err
+			return 0, err
 		}
+		keys[schedule.UserID] = true
+	}
 
-		builder, err := h.builder.NewBuilder(ctx, h.logger, account.UserID)
+	for _, group := range list {
+		_, err := h.scheduler.Set(groupJobKey(group.ID), group.Schedule, h.runGroup(group.ID))
 		if err != nil {
-			// skip as the user might have revoked access to their account
+			return 0, err
+		}
+		keys[groupJobKey(group.ID)] = true
+	}
+
+	_, err = h.scheduler.Set(wrappedJobKey, playlists.WrappedSpec, h.runWrapped)
+	if err != nil {
+		return 0, err
+	}
+	keys[wrappedJobKey] = true
+
+	h.scheduler.Retain(keys)
+
+	return len(keys), nil
+}
+
+// catchUp runs schedules once for runs that were due while no instance was running them, such as when the
+// process was asleep or down. Jobs with a run still in progress are left alone, as that run may be the one due.
+func (h *Handler) catchUp(ctx context.Context) {
+	running, err := h.scheduler.RunningJobs(ctx)
+	if err != nil {
+		h.logger.Log("event", "schedules.catchup.failed", "error", err)
+		return
+	}
+
+	schedules, err := h.scheduler.List(ctx)
+	if err != nil {
+		h.logger.Log("event", "schedules.catchup.failed", "error", err)
+		return
+	}
+
+	list, err := h.groups.List(ctx)
+	if err != nil {
+		h.logger.Log("event", "schedules.catchup.failed", "error", err)
+		return
+	}
+
+	subscribed, err := h.accounts.ListWrapped(ctx)
+	if err != nil {
+		h.logger.Log("event", "schedules.catchup.failed", "error", err)
+		return
+	}
+
+	now := time.Now()
+	for _, schedule := range schedules {
+		if ctx.Err() != nil {
+			return
+		}
+
+		missed, ok := schedule.MissedRun(now, h.maxLateness)
+		if !ok || running[schedule.UserID] {
 			continue
 		}
 
-		schedule.Spec = account.Schedule
-		schedule.Cmd = builder.Run(account.TrackLimit, account.WithConfirm)
+		h.logger.Log("event", "schedule.caughtup", "user", schedule.UserID, "missed", missed)
+		h.runScheduleDue(schedule.UserID, missed)
+	}
 
-		_, err = h.scheduler.Create(ctx, schedule)
-		if err != nil {
-			return idx, err
+	for _, group := range list {
+		if ctx.Err() != nil {
+			return
+		}
+
+		since := group.CreatedAt
+		if group.LastSuccessAt != nil {
+			since = *group.LastSuccessAt
+		}
+
+		missed, ok := scheduler.MissedRun(group.Schedule, since, now, h.maxLateness)
+		if !ok || running[groupJobKey(group.ID)] {
+			continue
+		}
+
+		h.logger.Log("event", "schedule.caughtup", "group", group.ID, "missed", missed)
+		h.runGroupDue(group.ID, missed)
+	}
+
+	if running[wrappedJobKey] {
+		return
+	}
+
+	for _, account := range subscribed {
+		if ctx.Err() != nil {
+			return
+		}
+
+		since := account.CreatedAt
+		if account.WrappedSuccessAt != nil {
+			since = *account.WrappedSuccessAt
+		}
+
+		missed, ok := scheduler.MissedRun(playlists.WrappedSpec, since, now, h.maxLateness)
+		if !ok {
+			continue
+		}
+
+		h.logger.Log("event", "schedule.caughtup", "user", account.UserID, "job", wrappedJobKey, "missed", missed)
+		h.runWrappedDue(ctx, account, missed)
+	}
+}
+
+func groupJobKey(groupID string) string {
+	return groupJobPrefix + groupID
+}
+
+// runSchedule covers the run of the user's schedule that has just come due
+func (h *Handler) runSchedule(userID string) func() {
+	return func() {
+		h.runScheduleDue(userID, time.Time{})
+	}
+}
+
+// runScheduleDue looks the account up when the run starts, so settings saved through another instance are picked
+// up. The run is claimed by the time it was due before it starts, defaulting to the latest due time of the schedule,
+// so that no due time is ever run twice.
+func (h *Handler) runScheduleDue(userID string, due time.Time) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	account, err := h.accounts.Get(ctx, userID)
+	if err != nil {
+		h.logger.Log("event", "account.get.failed", "user", userID, "error", err)
+		return
+	}
+
+	if due.IsZero() {
+		due = scheduler.GetPrevious(account.Schedule, time.Now())
+	}
+
+	claimed, err := h.scheduler.ClaimRun(ctx, userID, due)
+	if err != nil {
+		h.logger.Log("event", "run.claim.failed", "user", userID, "error", err)
+		return
+	}
+	if !claimed {
+		h.logger.Log("event", "run.skipped", "user", userID, "due", due)
+		return
+	}
+
+	run, err := h.scheduler.StartRun(ctx, userID, userID, account.Schedule, due)
+	if err != nil {
+		h.logger.Log("event", "run.start.failed", "user", userID, "error", err)
+		h.releaseClaim(ctx, userID, userID, due)
+		return
+	}
+
+	playlistID, err := h.runBuilder(ctx, account)
+	h.finishRun(ctx, run, playlistID, err)
+}
+
+// runGroup covers the run of the group's schedule that has just come due
+func (h *Handler) runGroup(groupID string) func() {
+	return func() {
+		h.runGroupDue(groupID, time.Time{})
+	}
+}
+
+// runGroupDue claims the run like runScheduleDue, recording it against the group's owner as the playlist is built on
+// their account
+func (h *Handler) runGroupDue(groupID string, due time.Time) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	group, err := h.groups.Get(ctx, groupID)
+	if err != nil {
+		switch {
+		case errors.Is(err, groups.ErrGroupNotFound):
+			// the group was deleted after its job was scheduled
+			h.logger.Log("event", "group.build.skipped", "group", groupID)
+		default:
+			h.logger.Log("event", "group.get.failed", "group", groupID, "error", err)
 		}
+		return
+	}
 
-		loaded++
+	if due.IsZero() {
+		due = scheduler.GetPrevious(group.Schedule, time.Now())
+	}
+
+	claimed, err := h.groups.ClaimRun(ctx, group.ID, due)
+	if err != nil {
+		h.logger.Log("event", "run.claim.failed", "group", group.ID, "error", err)
+		return
+	}
+	if !claimed {
+		h.logger.Log("event", "run.skipped", "group", group.ID, "due", due)
+		return
+	}
+
+	run, err := h.scheduler.StartRun(ctx, groupJobKey(group.ID), group.OwnerID, group.Schedule, due)
+	if err != nil {
+		h.logger.Log("event", "run.start.failed", "group", group.ID, "error", err)
+		h.releaseClaim(ctx, groupJobKey(group.ID), group.OwnerID, due)
+		return
+	}
+
+	playlistID, err := h.builder.RunGroup(ctx, h.logger, h.groups, group)
+	h.finishRun(ctx, run, playlistID, err)
+}
+
+func (h *Handler) runBuilder(ctx context.Context, account *accounts.Account) (string, error) {
+	builder, err := h.builder.NewBuilder(ctx, h.logger, account.UserID)
+	if err != nil {
+		// the user might have revoked access to their account
+		h.logger.Log("event", "builder.new.failed", "user", account.UserID, "error", err)
+		return "", fmt.Errorf("failed to access spotify account: %w", err)
+	}
+
+	return builder.Run(ctx, account)
+}
+
+const (
+	trackRefreshInterval = time.Hour
+	trackMaxAge          = 7 * 24 * time.Hour
+	trackRefreshLimit    = 500
+)
+
+// refreshTracks keeps cached track metadata up to date. It runs on the leader alone, so that replicas do not
+// spend the app's rate limit refreshing the same tracks.
+func (h *Handler) refreshTracks(ctx context.Context) {
+	h.logger.Log("event", "tracks.refresher.started")
+	defer h.logger.Log("event", "tracks.refresher.stopped")
+
+	ticker := time.NewTicker(trackRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			refreshed, err := playlists.RefreshTracks(ctx, h.appClient, h.tracks, trackMaxAge, trackRefreshLimit)
+			if err != nil {
+				h.logger.Log("event", "tracks.refresh.failed", "error", err)
+				continue
+			}
+			h.logger.Log("event", "tracks.refreshed", "refreshed", refreshed)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (h *Handler) runWrapped() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	due := scheduler.GetPrevious(playlists.WrappedSpec, time.Now())
+
+	subscribed, err := h.accounts.ListWrapped(ctx)
+	if err != nil {
+		h.logger.Log("event", "accounts.list.failed", "error", err)
+		return
+	}
+
+	for _, account := range subscribed {
+		h.runWrappedDue(ctx, account, due)
+	}
+}
+
+// runWrappedDue claims the review due at due for the account, so that it is only built once, and reviews the year
+// that had just ended at that time
+func (h *Handler) runWrappedDue(ctx context.Context, account *accounts.Account, due time.Time) {
+	claimed, err := h.accounts.ClaimWrapped(ctx, account.UserID, due)
+	if err != nil {
+		h.logger.Log("event", "run.claim.failed", "user", account.UserID, "job", wrappedJobKey, "error", err)
+		return
+	}
+	if !claimed {
+		h.logger.Log("event", "run.skipped", "user", account.UserID, "job", wrappedJobKey, "due", due)
+		return
+	}
+
+	run, err := h.scheduler.StartRun(ctx, wrappedJobKey, account.UserID, playlists.WrappedSpec, due)
+	if err != nil {
+		h.logger.Log("event", "run.start.failed", "user", account.UserID, "job", wrappedJobKey, "error", err)
+		h.releaseClaim(ctx, wrappedJobKey, account.UserID, due)
+		return
+	}
+
+	playlistID, err := h.runWrappedBuilder(ctx, account, playlists.WrappedYear(due))
+	h.finishRun(ctx, run, playlistID, err)
+}
+
+// finishRun records the outcome of a claimed run. The run only counts as done once it has succeeded, so a failed
+// run gives up its claim for catch-up to try it again.
+func (h *Handler) finishRun(ctx context.Context, run *scheduler.JobRun, playlistID string, runErr error) {
+	if err := h.scheduler.FinishRun(ctx, run, playlistID, runErr); err != nil {
+		h.logger.Log("event", "run.finish.failed", "job", run.Job, "run", run.ID, "error", err)
+	} else {
+		h.logger.Log("event", "run.finished", "job", run.Job, "user", run.UserID, "run", run.ID, "status", run.Status)
+	}
+
+	if err := h.settleClaim(ctx, run.Job, run.UserID, *run.DueAt, runErr == nil); err != nil {
+		h.logger.Log("event", "run.settle.failed", "job", run.Job, "run", run.ID, "error", err)
+	}
+}
+
+func (h *Handler) releaseClaim(ctx context.Context, key, userID string, due time.Time) {
+	if err := h.settleClaim(ctx, key, userID, due, false); err != nil {
+		h.logger.Log("event", "run.release.failed", "job", key, "error", err)
+	}
+}
+
+// settleClaim records a success against the claim on the run of the job registered under key, or gives the
+// claim up when the run failed
+func (h *Handler) settleClaim(ctx context.Context, key, userID string, due time.Time, succeeded bool) error {
+	switch {
+	case key == wrappedJobKey && succeeded:
+		return h.accounts.CompleteWrapped(ctx, userID, due)
+	case key == wrappedJobKey:
+		return h.accounts.ReleaseWrapped(ctx, userID, due)
+	case strings.HasPrefix(key, groupJobPrefix) && succeeded:
+		return h.groups.CompleteRun(ctx, strings.TrimPrefix(key, groupJobPrefix), due)
+	case strings.HasPrefix(key, groupJobPrefix):
+		return h.groups.ReleaseRun(ctx, strings.TrimPrefix(key, groupJobPrefix), due)
+	case succeeded:
+		return h.scheduler.CompleteRun(ctx, userID, due)
+	default:
+		return h.scheduler.ReleaseRun(ctx, userID, due)
+	}
+}
+
+func (h *Handler) runWrappedBuilder(ctx context.Context, account *accounts.Account, year int) (string, error) {
+	builder, err := h.builder.NewBuilder(ctx, h.logger, account.UserID)
+	if err != nil {
+		// the user might have revoked access to their account
+		h.logger.Log("event", "builder.new.failed", "user", account.UserID, "error", err)
+		return "", fmt.Errorf("failed to access spotify account: %w", err)
 	}
 
-	return loaded, nil
+	return builder.RunWrapped(ctx, account, year)
 }
 
 func (h *Handler) Shutdown(ctx context.Context) error {
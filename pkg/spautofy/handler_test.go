@@ -0,0 +1,232 @@
+package spautofy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/jace-ys/go-library/postgres"
+	"github.com/zmb3/spotify"
+	"golang.org/x/oauth2"
+
+	"github.com/jace-ys/spautofy/pkg/accounts"
+	"github.com/jace-ys/spautofy/pkg/mail"
+	"github.com/jace-ys/spautofy/pkg/playlists"
+	"github.com/jace-ys/spautofy/pkg/spotifytest"
+	"github.com/jace-ys/spautofy/pkg/users"
+)
+
+type recordingMailer struct {
+	mu           sync.Mutex
+	playlistURLs []string
+}
+
+func (m *recordingMailer) SendNewPlaylistEmail(user *users.User, withConfirm bool, playlistURL, unsubscribeURL string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.playlistURLs = append(m.playlistURLs, playlistURL)
+	return nil
+}
+
+func (m *recordingMailer) SendWrappedEmail(user *users.User, stats *mail.WrappedStats, playlistURL, unsubscribeURL string) error {
+	return nil
+}
+
+// newTestHandler returns a handler that talks to the fake Spotify API, against the database at TEST_DATABASE_URL
+// with its migrations applied
+func newTestHandler(t *testing.T, fake *spotifytest.Server, mailer mail.Mailer) *Handler {
+	t.Helper()
+
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	db, err := postgres.NewClient(databaseURL)
+	if err != nil {
+		t.Fatalf("failed to connect to database: %v", err)
+	}
+
+	baseURL, err := url.Parse("http://spautofy.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &Config{
+		BaseURL:         baseURL,
+		SessionStoreKey: "spautofy-test",
+		MaxLateness:     time.Hour,
+		Spotify: SpotifyConfig{
+			ClientID:     "client-id",
+			ClientSecret: "client-secret",
+			Transport:    fake.Transport(),
+		},
+		Mailer: mailer,
+	}
+
+	return NewHandler(log.NewNopLogger(), cfg, db)
+}
+
+func TestBuildConfirmRender(t *testing.T) {
+	ctx := context.Background()
+
+	userID := fmt.Sprintf("spautofy-test-%d", time.Now().UnixNano())
+	spotifyUser := &spotify.PrivateUser{
+		User:  spotify.User{ID: userID, DisplayName: "Test User"},
+		Email: userID + "@example.com",
+	}
+
+	scopes := []string{spotify.ScopeUserTopRead, spotify.ScopePlaylistModifyPrivate}
+	fake := spotifytest.NewServer(spotifyUser, scopes...)
+	defer fake.Close()
+
+	trackIDs := make([]spotify.ID, 3)
+	for idx := range trackIDs {
+		id := spotify.ID(fmt.Sprintf("%s-track%d", userID, idx+1))
+		fake.AddTracks(spotify.FullTrack{
+			SimpleTrack: spotify.SimpleTrack{
+				ID:      id,
+				Name:    fmt.Sprintf("Track %d", idx+1),
+				Artists: []spotify.SimpleArtist{{Name: "Artist"}},
+				URI:     spotify.URI("spotify:track:" + id),
+			},
+			Album: spotify.SimpleAlbum{Name: "Album"},
+		})
+		trackIDs[idx] = id
+	}
+	fake.SetTopTracks(playlists.TimerangeShort, trackIDs...)
+
+	mailer := &recordingMailer{}
+	h := newTestHandler(t, fake, mailer)
+
+	token := (&oauth2.Token{
+		AccessToken:  spotifytest.AccessToken,
+		RefreshToken: spotifytest.RefreshToken,
+		TokenType:    "Bearer",
+		Expiry:       time.Now().Add(time.Hour),
+	}).WithExtra(map[string]interface{}{
+		"scope": strings.Join(scopes, " "),
+	})
+
+	_, err := h.users.CreateOrUpdate(ctx, users.NewUser(spotifyUser, token))
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	defer h.users.Delete(ctx, userID)
+
+	account := accounts.NewAccount(userID, "0 0 1 * *", len(trackIDs), playlists.TimerangeShort, true)
+	_, err = h.accounts.Create(ctx, account)
+	if err != nil {
+		t.Fatalf("failed to create account: %v", err)
+	}
+
+	// build: a playlist waiting on confirmation is only saved, so nothing is created on Spotify yet
+	playlistID, err := h.runBuilder(ctx, account)
+	if err != nil {
+		t.Fatalf("failed to build playlist: %v", err)
+	}
+
+	if count := fake.PlaylistCount(); count != 0 {
+		t.Fatalf("expected no playlists on Spotify before confirmation, got %d", count)
+	}
+
+	playlistPath := path.Join("/accounts", userID, "playlists", playlistID)
+	if len(mailer.playlistURLs) != 1 || mailer.playlistURLs[0] != "http://spautofy.test"+playlistPath {
+		t.Fatalf("expected a confirmation email linking to %s, got %v", playlistPath, mailer.playlistURLs)
+	}
+
+	cookies := newSession(t, h, userID)
+
+	// render: every selected track is listed for the user to confirm
+	resp := serve(h, http.MethodGet, playlistPath, nil, cookies)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status %d rendering playlist, got %d", http.StatusOK, resp.Code)
+	}
+	for idx := range trackIDs {
+		if name := fmt.Sprintf("Track %d", idx+1); !strings.Contains(resp.Body.String(), name) {
+			t.Errorf("expected rendered playlist to list %q", name)
+		}
+	}
+
+	// confirm: only the tracks left selected are added, in their original order
+	form := url.Values{}
+	form.Set(string(trackIDs[2]), "on")
+	form.Set(string(trackIDs[0]), "on")
+
+	resp = serve(h, http.MethodPost, playlistPath, form, cookies)
+	if resp.Code != http.StatusFound {
+		t.Fatalf("expected status %d confirming playlist, got %d", http.StatusFound, resp.Code)
+	}
+
+	playlist, err := h.playlists.Get(ctx, userID, playlistID)
+	if err != nil {
+		t.Fatalf("failed to get playlist: %v", err)
+	}
+
+	if playlist.BuildStep != playlists.BuildStepFinished {
+		t.Fatalf("expected build step %q, got %q", playlists.BuildStepFinished, playlist.BuildStep)
+	}
+
+	added, ok := fake.PlaylistTracks(playlist.SpotifyID)
+	if !ok {
+		t.Fatalf("expected playlist %s to be created on Spotify", playlist.SpotifyID)
+	}
+	if len(added) != 2 || added[0] != trackIDs[0] || added[1] != trackIDs[2] {
+		t.Fatalf("expected tracks %v, got %v", []spotify.ID{trackIDs[0], trackIDs[2]}, added)
+	}
+
+	// render again: the finished playlist links to Spotify
+	resp = serve(h, http.MethodGet, playlistPath, nil, cookies)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("expected status %d rendering playlist, got %d", http.StatusOK, resp.Code)
+	}
+	if !strings.Contains(resp.Body.String(), playlist.SpotifyURL) {
+		t.Errorf("expected rendered playlist to link to %s", playlist.SpotifyURL)
+	}
+}
+
+// newSession signs userID in without going through Spotify's authorization flow
+func newSession(t *testing.T, h *Handler, userID string) []*http.Cookie {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/login/callback", nil)
+
+	values := make(map[interface{}]interface{})
+	values[userIDKey{}] = userID
+
+	_, err := h.sessions.CreateWithValues(w, r, values)
+	if err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+
+	return w.Result().Cookies()
+}
+
+func serve(h *Handler, method, target string, form url.Values, cookies []*http.Cookie) *httptest.ResponseRecorder {
+	var r *http.Request
+	if form != nil {
+		r = httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		r = httptest.NewRequest(method, target, nil)
+	}
+
+	for _, cookie := range cookies {
+		r.AddCookie(cookie)
+	}
+
+	w := httptest.NewRecorder()
+	h.server.Handler.ServeHTTP(w, r)
+	return w
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/zmb3/spotify"
 
+	"github.com/jace-ys/spautofy/pkg/accounts"
 	"github.com/jace-ys/spautofy/pkg/playlists"
 )
 
@@ -21,9 +22,9 @@ func (h *Handler) createPlaylist() http.HandlerFunc {
 		}
 
 		userID := mux.Vars(r)["userID"]
-		playlistName := mux.Vars(r)["playlistName"]
+		playlistID := mux.Vars(r)["playlistID"]
 
-		playlist, err := h.playlists.Get(r.Context(), userID, playlistName)
+		playlist, err := h.playlists.Get(r.Context(), userID, playlistID)
 		if err != nil {
 			switch {
 			case errors.Is(err, playlists.ErrPlaylistNotFound):
@@ -35,44 +36,67 @@ func (h *Handler) createPlaylist() http.HandlerFunc {
 				return
 			}
 		}
-		playlist.TrackIDs = tracks
+		playlist.TrackIDs = selectTracks(playlist.TrackIDs, tracks)
 
-		if playlist.SnapshotID == "" {
-			builder, err := h.builder.NewBuilder(r.Context(), h.logger, playlist.UserID)
+		if playlist.BuildStep != playlists.BuildStepFinished {
+			account, err := h.accounts.Get(r.Context(), playlist.UserID)
 			if err != nil {
-				h.logger.Log("event", "builder.new.failed", "error", err)
-				h.renderError(http.StatusInternalServerError).ServeHTTP(w, r)
-				return
+				switch {
+				case errors.Is(err, accounts.ErrAccountNotFound):
+					h.renderError(http.StatusNotFound).ServeHTTP(w, r)
+					return
+				default:
+					h.logger.Log("event", "account.get.failed", "error", err)
+					h.renderError(http.StatusInternalServerError).ServeHTTP(w, r)
+					return
+				}
 			}
 
-			err = builder.Build(playlist)
+			builder, err := h.builder.NewBuilder(r.Context(), h.logger, playlist.UserID)
 			if err != nil {
-				h.logger.Log("event", "playlist.build.failed", "error", err)
+				h.logger.Log("event", "builder.new.failed", "error", err)
 				h.renderError(http.StatusInternalServerError).ServeHTTP(w, r)
 				return
 			}
 
-			id, err := h.playlists.Update(r.Context(), playlist)
+			err = builder.Build(r.Context(), account, playlist)
 			if err != nil {
 				switch {
 				case errors.Is(err, playlists.ErrPlaylistNotFound):
 					h.renderError(http.StatusNotFound).ServeHTTP(w, r)
 					return
 				default:
-					h.logger.Log("event", "playlist.update.failed", "error", err)
+					h.logger.Log("event", "playlist.build.failed", "error", err)
 					h.renderError(http.StatusInternalServerError).ServeHTTP(w, r)
 					return
 				}
 			}
 
-			h.logger.Log("event", "playlist.built", "user", playlist.UserID, "id", id)
+			h.logger.Log("event", "playlist.built", "user", playlist.UserID, "id", playlist.ID)
 		}
 
-		w.Header().Set("Location", path.Join("/accounts", playlist.UserID, "playlists", playlist.Name))
+		w.Header().Set("Location", path.Join("/accounts", playlist.UserID, "playlists", playlist.ID))
 		w.WriteHeader(http.StatusFound)
 	}
 }
 
+// selectTracks keeps the tracks that were selected, in the order they were originally sequenced
+func selectTracks(trackIDs, selected []spotify.ID) []spotify.ID {
+	keep := make(map[spotify.ID]bool, len(selected))
+	for _, id := range selected {
+		keep[id] = true
+	}
+
+	var tracks []spotify.ID
+	for _, id := range trackIDs {
+		if keep[id] {
+			tracks = append(tracks, id)
+		}
+	}
+
+	return tracks
+}
+
 func (h *Handler) parsePlaylistForm(r *http.Request) ([]spotify.ID, error) {
 	err := r.ParseForm()
 	if err != nil {
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"html/template"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -33,19 +34,58 @@ func (h *Handler) renderIndex() http.HandlerFunc {
 	}
 }
 
+const (
+	accountRunsLimit = 10
+)
+
 func (h *Handler) renderAccount() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		data := struct {
-			UserID        string
-			UserFirstName string
-			Frequency     int
-			TrackLimit    int
-			WithConfirm   bool
-			Next          time.Time
+			UserID              string
+			UserFirstName       string
+			Frequency           string
+			Weekday             int
+			Day                 int
+			Days                []int
+			Spec                string
+			ScheduleDescription string
+			TrackLimit          int
+			Timerange           string
+			DiscoveryRatio      int
+			Freshness           int
+			NameTemplate        string
+			DescriptionTemplate string
+			NamePreview         string
+			DescriptionPreview  string
+			Mode                string
+			Visibility          string
+			Ordering            string
+			Source              string
+			ArtistTrackLimit    int
+			GenreInclude        string
+			GenreExclude        string
+			WithCover           bool
+			WithoutExplicit     bool
+			WithWrapped         bool
+			WithConfirm         bool
+			Next                time.Time
+			Runs                []*scheduler.JobRun
 		}{
-			WithConfirm: true,
-			TrackLimit:  20,
-			Frequency:   12,
+			Mode:             playlists.ModeNew,
+			Visibility:       playlists.VisibilityPrivate,
+			Ordering:         playlists.OrderingRank,
+			Source:           playlists.SourceTopTracks,
+			ArtistTrackLimit: 3,
+			WithCover:        true,
+			WithConfirm:      true,
+			TrackLimit:       20,
+			Frequency:        scheduler.FrequencyMonthly,
+			Weekday:          int(time.Monday),
+			Day:              1,
+		}
+
+		for day := 1; day <= scheduler.MaxMonthDay; day++ {
+			data.Days = append(data.Days, day)
 		}
 
 		userID := mux.Vars(r)["userID"]
@@ -63,7 +103,9 @@ func (h *Handler) renderAccount() http.HandlerFunc {
 			}
 		}
 		data.UserID = user.PrivateUser.ID
-		data.UserFirstName = strings.Split(user.PrivateUser.DisplayName, " ")[0]
+		data.UserFirstName = user.FirstName()
+
+		schedule, _ := scheduler.NewSpec(data.Frequency, time.Weekday(data.Weekday), data.Day, "")
 
 		account, err := h.accounts.Get(r.Context(), user.ID)
 		if err != nil {
@@ -76,30 +118,112 @@ func (h *Handler) renderAccount() http.HandlerFunc {
 				return
 			}
 		} else {
-			data.Frequency = scheduler.SpecToFrequency(account.Schedule)
+			schedule = account.Schedule
+			frequency, weekday, day := scheduler.ParseSpec(account.Schedule)
+			data.Frequency = frequency
+			data.Weekday = int(weekday)
+			data.Day = day
+			data.Spec = account.Schedule
 			data.TrackLimit = account.TrackLimit
+			data.Timerange = account.Timerange
+			data.DiscoveryRatio = account.DiscoveryRatio
+			data.Freshness = account.Freshness
+			data.NameTemplate = account.NameTemplate
+			data.DescriptionTemplate = account.DescriptionTemplate
+			data.Mode = account.Mode
+			data.Visibility = account.Visibility
+			data.Ordering = account.Ordering
+			data.Source = account.Source
+			data.ArtistTrackLimit = account.ArtistTrackLimit
+			data.GenreInclude = strings.Join(account.GenreInclude, ", ")
+			data.GenreExclude = strings.Join(account.GenreExclude, ", ")
+			data.WithCover = account.WithCover
+			data.WithoutExplicit = account.WithoutExplicit
+			data.WithWrapped = account.WithWrapped
 			data.WithConfirm = account.WithConfirm
 			data.Next = scheduler.GetNext(account.Schedule)
 		}
 
+		data.ScheduleDescription = scheduler.DescribeSpec(schedule)
+
+		data.Runs, err = h.scheduler.ListRuns(r.Context(), user.ID, accountRunsLimit)
+		if err != nil {
+			h.logger.Log("event", "runs.list.failed", "error", err)
+			h.renderError(http.StatusInternalServerError).ServeHTTP(w, r)
+			return
+		}
+
+		preview := newPreviewData(schedule, data.TrackLimit, data.UserFirstName)
+		data.NamePreview, data.DescriptionPreview, err = preview.RenderNameAndDescription(data.NameTemplate, data.DescriptionTemplate)
+		if err != nil {
+			h.logger.Log("event", "template.preview.failed", "error", err)
+		}
+
 		h.logger.Log("event", "template.rendered", "template", "account", "user", user.ID)
 		tmpls.ExecuteTemplate(w, "account", data)
 	}
 }
 
-func (h *Handler) renderPlaylist() http.HandlerFunc {
+const (
+	playlistsPageSize = 20
+)
+
+func (h *Handler) renderPlaylists() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		data := struct {
-			UserID string
-			Name   string
-			Link   string
-			Tracks []*playlists.Track
+			UserID    string
+			Playlists []*playlists.Playlist
+			PrevPage  int
+			NextPage  int
 		}{}
 
 		userID := mux.Vars(r)["userID"]
-		playlistName := mux.Vars(r)["playlistName"]
 
-		playlist, err := h.playlists.Get(r.Context(), userID, playlistName)
+		page, err := strconv.Atoi(r.URL.Query().Get("page"))
+		if err != nil || page < 1 {
+			page = 1
+		}
+
+		// fetch one extra playlist to tell whether there is a next page
+		list, err := h.playlists.List(r.Context(), userID, playlistsPageSize+1, (page-1)*playlistsPageSize)
+		if err != nil {
+			h.logger.Log("event", "playlists.list.failed", "error", err)
+			h.renderError(http.StatusInternalServerError).ServeHTTP(w, r)
+			return
+		}
+
+		if len(list) > playlistsPageSize {
+			list = list[:playlistsPageSize]
+			data.NextPage = page + 1
+		}
+
+		data.UserID = userID
+		data.Playlists = list
+		data.PrevPage = page - 1
+
+		h.logger.Log("event", "template.rendered", "template", "playlists", "user", userID, "page", page)
+		tmpls.ExecuteTemplate(w, "playlists", data)
+	}
+}
+
+func (h *Handler) renderPlaylist() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := struct {
+			UserID        string
+			PlaylistID    string
+			Name          string
+			Link          string
+			HasHistory    bool
+			ExportFormats []string
+			Tracks        []*playlists.Track
+		}{
+			ExportFormats: []string{playlists.FormatM3U, playlists.FormatXSPF, playlists.FormatJSPF, playlists.FormatCSV, playlists.FormatJSON},
+		}
+
+		userID := mux.Vars(r)["userID"]
+		playlistID := mux.Vars(r)["playlistID"]
+
+		playlist, err := h.playlists.Get(r.Context(), userID, playlistID)
 		if err != nil {
 			switch {
 			case errors.Is(err, playlists.ErrPlaylistNotFound):
@@ -112,31 +236,127 @@ func (h *Handler) renderPlaylist() http.HandlerFunc {
 			}
 		}
 
-		builder, err := h.builder.NewBuilder(r.Context(), h.logger, playlist.UserID)
-		if err != nil {
-			h.logger.Log("event", "builder.new.failed", "error", err)
-			h.renderError(http.StatusInternalServerError).ServeHTTP(w, r)
-			return
-		}
-
 		data.UserID = playlist.UserID
+		data.PlaylistID = playlist.ID
 		data.Name = playlist.Name
-		data.Tracks, err = builder.FetchTracks(playlist.TrackIDs)
+		data.Tracks, err = h.builder.FetchTracks(r.Context(), h.logger, playlist.UserID, playlist.TrackIDs)
 		if err != nil {
 			h.logger.Log("event", "tracks.fetch.failed", "error", err)
 			h.renderError(http.StatusInternalServerError).ServeHTTP(w, r)
 			return
 		}
 
+		for _, track := range data.Tracks {
+			track.Recommended = playlist.IsRecommended(track.ID)
+		}
+
 		if playlist.SpotifyURL != "" {
 			data.Link = playlist.SpotifyURL
 		}
 
-		h.logger.Log("event", "template.rendered", "template", "playlist", "user", userID, "playlist", playlist.Name)
+		versions, err := h.playlists.ListVersions(r.Context(), userID, playlist.ID)
+		if err != nil {
+			h.logger.Log("event", "versions.list.failed", "error", err)
+			h.renderError(http.StatusInternalServerError).ServeHTTP(w, r)
+			return
+		}
+		data.HasHistory = len(versions) > 0
+
+		h.logger.Log("event", "template.rendered", "template", "playlist", "user", userID, "playlist", playlist.ID)
 		tmpls.ExecuteTemplate(w, "playlist", data)
 	}
 }
 
+func (h *Handler) renderPlaylistHistory() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := struct {
+			UserID     string
+			PlaylistID string
+			Name       string
+			Versions   []*playlists.Version
+		}{}
+
+		userID := mux.Vars(r)["userID"]
+		playlistID := mux.Vars(r)["playlistID"]
+
+		playlist, err := h.playlists.Get(r.Context(), userID, playlistID)
+		if err != nil {
+			switch {
+			case errors.Is(err, playlists.ErrPlaylistNotFound):
+				h.renderError(http.StatusNotFound).ServeHTTP(w, r)
+				return
+			default:
+				h.logger.Log("event", "playlist.get.failed", "error", err)
+				h.renderError(http.StatusInternalServerError).ServeHTTP(w, r)
+				return
+			}
+		}
+
+		versions, err := h.playlists.ListVersions(r.Context(), userID, playlist.ID)
+		if err != nil {
+			h.logger.Log("event", "versions.list.failed", "error", err)
+			h.renderError(http.StatusInternalServerError).ServeHTTP(w, r)
+			return
+		}
+
+		data.UserID = userID
+		data.PlaylistID = playlist.ID
+		data.Name = playlist.Name
+		data.Versions = versions
+
+		h.logger.Log("event", "template.rendered", "template", "history", "user", userID, "playlist", playlist.ID)
+		tmpls.ExecuteTemplate(w, "history", data)
+	}
+}
+
+func (h *Handler) renderPlaylistVersion() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := struct {
+			UserID     string
+			PlaylistID string
+			Name       string
+			CreatedAt  time.Time
+			Tracks     []*playlists.Track
+		}{}
+
+		userID := mux.Vars(r)["userID"]
+		playlistID := mux.Vars(r)["playlistID"]
+		versionID := mux.Vars(r)["versionID"]
+
+		version, err := h.playlists.GetVersion(r.Context(), userID, versionID)
+		if err != nil {
+			switch {
+			case errors.Is(err, playlists.ErrVersionNotFound):
+				h.renderError(http.StatusNotFound).ServeHTTP(w, r)
+				return
+			default:
+				h.logger.Log("event", "version.get.failed", "error", err)
+				h.renderError(http.StatusInternalServerError).ServeHTTP(w, r)
+				return
+			}
+		}
+
+		if version.PlaylistID != playlistID {
+			h.renderError(http.StatusNotFound).ServeHTTP(w, r)
+			return
+		}
+
+		data.UserID = version.UserID
+		data.PlaylistID = version.PlaylistID
+		data.Name = version.Name
+		data.CreatedAt = version.CreatedAt
+		data.Tracks, err = h.builder.FetchTracks(r.Context(), h.logger, version.UserID, version.TrackIDs)
+		if err != nil {
+			h.logger.Log("event", "tracks.fetch.failed", "error", err)
+			h.renderError(http.StatusInternalServerError).ServeHTTP(w, r)
+			return
+		}
+
+		h.logger.Log("event", "template.rendered", "template", "version", "user", userID, "version", version.ID)
+		tmpls.ExecuteTemplate(w, "version", data)
+	}
+}
+
 func (h *Handler) renderError(status int) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		data := struct {
@@ -144,6 +364,8 @@ func (h *Handler) renderError(status int) http.HandlerFunc {
 		}{}
 
 		switch status {
+		case http.StatusBadRequest:
+			data.Message = "Some of the submitted settings are invalid. Please check them and try again."
 		case http.StatusUnauthorized:
 			data.Message = "You need to be logged in to view this page."
 		case http.StatusForbidden:
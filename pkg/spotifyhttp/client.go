@@ -0,0 +1,46 @@
+package spotifyhttp
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/zmb3/spotify"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+type tokenSource struct {
+	client *spotify.Client
+}
+
+func (ts *tokenSource) Token() (*oauth2.Token, error) {
+	return ts.client.Token()
+}
+
+func NewClient(authenticator *spotify.Authenticator, token *oauth2.Token, transport http.RoundTripper) *spotify.Client {
+	// the authenticator's own client is kept only to refresh tokens, while API calls go through the given transport
+	auth := authenticator.NewClient(token)
+
+	client := spotify.NewClient(&http.Client{
+		Transport: &oauth2.Transport{
+			Source: oauth2.ReuseTokenSource(token, &tokenSource{client: &auth}),
+			Base:   transport,
+		},
+	})
+
+	return &client
+}
+
+// NewAppClient returns a client authenticated as the app itself, for reading catalogue data outside of any user's session
+func NewAppClient(clientID, clientSecret string, transport http.RoundTripper) *spotify.Client {
+	cfg := &clientcredentials.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		TokenURL:     spotify.TokenURL,
+	}
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, &http.Client{Transport: transport})
+	client := spotify.NewClient(cfg.Client(ctx))
+
+	return &client
+}
@@ -0,0 +1,186 @@
+package spotifyhttp
+
+import (
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	defaultMaxRetries    = 4
+	defaultBaseDelay     = 500 * time.Millisecond
+	defaultMaxDelay      = 30 * time.Second
+	defaultMaxRetryAfter = 2 * time.Minute
+)
+
+var (
+	retriesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "spautofy",
+		Subsystem: "spotify",
+		Name:      "retries_total",
+		Help:      "Number of Spotify API requests that were retried.",
+	}, []string{"method", "reason"})
+
+	retriesExhaustedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "spautofy",
+		Subsystem: "spotify",
+		Name:      "retries_exhausted_total",
+		Help:      "Number of Spotify API requests that still failed after all retries.",
+	}, []string{"method", "reason"})
+)
+
+// creating a playlist is not idempotent, but Spotify rejects rate limited requests before doing any work
+var createPlaylistPath = regexp.MustCompile(`^/v1/users/[^/]+/playlists$`)
+
+type Transport struct {
+	Base          http.RoundTripper
+	MaxRetries    int
+	BaseDelay     time.Duration
+	MaxDelay      time.Duration
+	MaxRetryAfter time.Duration
+}
+
+func NewTransport(base http.RoundTripper) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &Transport{
+		Base:          base,
+		MaxRetries:    defaultMaxRetries,
+		BaseDelay:     defaultBaseDelay,
+		MaxDelay:      defaultMaxDelay,
+		MaxRetryAfter: defaultMaxRetryAfter,
+	}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		r, err := rewind(req, attempt)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := t.Base.RoundTrip(r)
+
+		reason := retryReason(req, resp, err)
+		if reason == "" {
+			return resp, err
+		}
+
+		delay, ok := t.delay(attempt, resp)
+		if !ok || attempt >= t.MaxRetries {
+			retriesExhaustedTotal.WithLabelValues(req.Method, reason).Inc()
+			return resp, err
+		}
+
+		if resp != nil {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		retriesTotal.WithLabelValues(req.Method, reason).Inc()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func rewind(req *http.Request, attempt int) (*http.Request, error) {
+	if attempt == 0 || req.Body == nil || req.Body == http.NoBody {
+		return req, nil
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+
+	r := req.Clone(req.Context())
+	r.Body = body
+	return r, nil
+}
+
+func retryReason(req *http.Request, resp *http.Response, err error) string {
+	// a request whose body cannot be replayed can only ever be sent once
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return ""
+	}
+
+	switch {
+	case resp != nil && resp.StatusCode == http.StatusTooManyRequests:
+		if idempotent(req) || isCreatePlaylist(req) {
+			return "rate_limited"
+		}
+	case !idempotent(req):
+		return ""
+	case err != nil:
+		return "network_error"
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return "server_error"
+	}
+
+	return ""
+}
+
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+func isCreatePlaylist(req *http.Request) bool {
+	return req.Method == http.MethodPost && createPlaylistPath.MatchString(req.URL.Path)
+}
+
+func (t *Transport) delay(attempt int, resp *http.Response) (time.Duration, bool) {
+	if resp != nil {
+		if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			return retryAfter, retryAfter <= t.MaxRetryAfter
+		}
+	}
+
+	// exponential backoff with equal jitter, so concurrent builds do not retry in lockstep
+	backoff := t.BaseDelay << uint(attempt)
+	if backoff <= 0 || backoff > t.MaxDelay {
+		backoff = t.MaxDelay
+	}
+
+	half := backoff / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1)), true
+}
+
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		delay := time.Until(date)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+
+	return 0, false
+}
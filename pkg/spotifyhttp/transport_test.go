@@ -0,0 +1,330 @@
+package spotifyhttp
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+type stubResponse struct {
+	status     int
+	retryAfter string
+	err        error
+}
+
+// stubTransport replies with each response in turn, repeating the last one once they run out, and records the
+// bodies it was sent
+func stubTransport(responses ...stubResponse) (http.RoundTripper, *[]string) {
+	var bodies []string
+	return roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		var body string
+		if req.Body != nil {
+			b, err := ioutil.ReadAll(req.Body)
+			if err != nil {
+				return nil, err
+			}
+			body = string(b)
+		}
+
+		idx := len(bodies)
+		if idx >= len(responses) {
+			idx = len(responses) - 1
+		}
+		bodies = append(bodies, body)
+
+		r := responses[idx]
+		if r.err != nil {
+			return nil, r.err
+		}
+
+		resp := &http.Response{
+			StatusCode: r.status,
+			Header:     make(http.Header),
+			Body:       ioutil.NopCloser(strings.NewReader("")),
+			Request:    req,
+		}
+		if r.retryAfter != "" {
+			resp.Header.Set("Retry-After", r.retryAfter)
+		}
+		return resp, nil
+	}), &bodies
+}
+
+func TestTransportRoundTrip(t *testing.T) {
+	tracksURL := "https://api.spotify.com/v1/playlists/playlist-id/tracks"
+	createURL := "https://api.spotify.com/v1/users/user-id/playlists"
+	errNetwork := errors.New("connection reset")
+
+	tests := []struct {
+		name      string
+		method    string
+		url       string
+		body      string
+		replay    bool
+		responses []stubResponse
+		status    int
+		err       bool
+		calls     int
+	}{
+		{
+			name:      "success",
+			method:    http.MethodGet,
+			url:       tracksURL,
+			responses: []stubResponse{{status: http.StatusOK}},
+			status:    http.StatusOK,
+			calls:     1,
+		},
+		{
+			name:      "client error",
+			method:    http.MethodGet,
+			url:       tracksURL,
+			responses: []stubResponse{{status: http.StatusNotFound}},
+			status:    http.StatusNotFound,
+			calls:     1,
+		},
+		{
+			name:      "server error then success",
+			method:    http.MethodGet,
+			url:       tracksURL,
+			responses: []stubResponse{{status: http.StatusServiceUnavailable}, {status: http.StatusOK}},
+			status:    http.StatusOK,
+			calls:     2,
+		},
+		{
+			name:      "network error then success",
+			method:    http.MethodGet,
+			url:       tracksURL,
+			responses: []stubResponse{{err: errNetwork}, {status: http.StatusOK}},
+			status:    http.StatusOK,
+			calls:     2,
+		},
+		{
+			name:      "rate limited then success",
+			method:    http.MethodGet,
+			url:       tracksURL,
+			responses: []stubResponse{{status: http.StatusTooManyRequests, retryAfter: "0"}, {status: http.StatusOK}},
+			status:    http.StatusOK,
+			calls:     2,
+		},
+		{
+			name:      "retry after too long",
+			method:    http.MethodGet,
+			url:       tracksURL,
+			responses: []stubResponse{{status: http.StatusTooManyRequests, retryAfter: "3600"}},
+			status:    http.StatusTooManyRequests,
+			calls:     1,
+		},
+		{
+			name:      "retries exhausted",
+			method:    http.MethodGet,
+			url:       tracksURL,
+			responses: []stubResponse{{status: http.StatusBadGateway}},
+			status:    http.StatusBadGateway,
+			calls:     4,
+		},
+		{
+			name:      "put is retried",
+			method:    http.MethodPut,
+			url:       tracksURL,
+			body:      `{"uris":[]}`,
+			replay:    true,
+			responses: []stubResponse{{status: http.StatusInternalServerError}, {status: http.StatusOK}},
+			status:    http.StatusOK,
+			calls:     2,
+		},
+		{
+			name:      "post server error",
+			method:    http.MethodPost,
+			url:       tracksURL,
+			body:      `{"uris":[]}`,
+			replay:    true,
+			responses: []stubResponse{{status: http.StatusInternalServerError}, {status: http.StatusCreated}},
+			status:    http.StatusInternalServerError,
+			calls:     1,
+		},
+		{
+			name:      "post rate limited",
+			method:    http.MethodPost,
+			url:       tracksURL,
+			body:      `{"uris":[]}`,
+			replay:    true,
+			responses: []stubResponse{{status: http.StatusTooManyRequests, retryAfter: "0"}, {status: http.StatusCreated}},
+			status:    http.StatusTooManyRequests,
+			calls:     1,
+		},
+		{
+			name:      "post network error",
+			method:    http.MethodPost,
+			url:       tracksURL,
+			body:      `{"uris":[]}`,
+			replay:    true,
+			responses: []stubResponse{{err: errNetwork}, {status: http.StatusCreated}},
+			err:       true,
+			calls:     1,
+		},
+		{
+			name:      "create playlist rate limited",
+			method:    http.MethodPost,
+			url:       createURL,
+			body:      `{"name":"Spautofy"}`,
+			replay:    true,
+			responses: []stubResponse{{status: http.StatusTooManyRequests, retryAfter: "0"}, {status: http.StatusCreated}},
+			status:    http.StatusCreated,
+			calls:     2,
+		},
+		{
+			name:      "create playlist server error",
+			method:    http.MethodPost,
+			url:       createURL,
+			body:      `{"name":"Spautofy"}`,
+			replay:    true,
+			responses: []stubResponse{{status: http.StatusInternalServerError}, {status: http.StatusCreated}},
+			status:    http.StatusInternalServerError,
+			calls:     1,
+		},
+		{
+			name:      "body cannot be replayed",
+			method:    http.MethodPut,
+			url:       tracksURL,
+			body:      `{"uris":[]}`,
+			responses: []stubResponse{{status: http.StatusTooManyRequests, retryAfter: "0"}, {status: http.StatusOK}},
+			status:    http.StatusTooManyRequests,
+			calls:     1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base, bodies := stubTransport(tt.responses...)
+			transport := &Transport{
+				Base:          base,
+				MaxRetries:    3,
+				BaseDelay:     time.Millisecond,
+				MaxDelay:      time.Millisecond,
+				MaxRetryAfter: time.Minute,
+			}
+
+			req, err := http.NewRequest(tt.method, tt.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.body != "" {
+				if tt.replay {
+					req, err = http.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+					if err != nil {
+						t.Fatal(err)
+					}
+				} else {
+					req.Body = ioutil.NopCloser(strings.NewReader(tt.body))
+				}
+			}
+
+			resp, err := transport.RoundTrip(req)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected an error, got status %d", resp.StatusCode)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if resp.StatusCode != tt.status {
+					t.Errorf("expected status %d, got %d", tt.status, resp.StatusCode)
+				}
+			}
+
+			if len(*bodies) != tt.calls {
+				t.Fatalf("expected %d calls, got %d", tt.calls, len(*bodies))
+			}
+			for idx, body := range *bodies {
+				if body != tt.body {
+					t.Errorf("expected call %d to send body %q, got %q", idx, tt.body, body)
+				}
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		delay time.Duration
+		ok    bool
+	}{
+		{name: "missing", value: ""},
+		{name: "seconds", value: "30", delay: 30 * time.Second, ok: true},
+		{name: "zero", value: "0", ok: true},
+		{name: "negative", value: "-1"},
+		{name: "date in the past", value: "Wed, 21 Oct 2015 07:28:00 GMT", ok: true},
+		{name: "garbage", value: "soon"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delay, ok := parseRetryAfter(tt.value)
+			if delay != tt.delay || ok != tt.ok {
+				t.Errorf("expected (%s, %t), got (%s, %t)", tt.delay, tt.ok, delay, ok)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfterFutureDate(t *testing.T) {
+	value := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+
+	delay, ok := parseRetryAfter(value)
+	if !ok || delay <= 0 || delay > time.Minute {
+		t.Errorf("expected a delay of up to a minute, got (%s, %t)", delay, ok)
+	}
+}
+
+func TestTransportDelay(t *testing.T) {
+	transport := &Transport{
+		BaseDelay:     time.Second,
+		MaxDelay:      10 * time.Second,
+		MaxRetryAfter: time.Minute,
+	}
+
+	tests := []struct {
+		name       string
+		attempt    int
+		retryAfter string
+		min        time.Duration
+		max        time.Duration
+		ok         bool
+	}{
+		{name: "first attempt", attempt: 0, min: 500 * time.Millisecond, max: time.Second, ok: true},
+		{name: "third attempt", attempt: 2, min: 2 * time.Second, max: 4 * time.Second, ok: true},
+		{name: "capped", attempt: 10, min: 5 * time.Second, max: 10 * time.Second, ok: true},
+		{name: "overflow is capped", attempt: 100, min: 5 * time.Second, max: 10 * time.Second, ok: true},
+		{name: "retry after", attempt: 0, retryAfter: "20", min: 20 * time.Second, max: 20 * time.Second, ok: true},
+		{name: "retry after too long", attempt: 0, retryAfter: "120", min: 2 * time.Minute, max: 2 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{Header: make(http.Header)}
+			if tt.retryAfter != "" {
+				resp.Header.Set("Retry-After", tt.retryAfter)
+			}
+
+			// the jitter is random, so a few delays are checked against the range
+			for i := 0; i < 10; i++ {
+				delay, ok := transport.delay(tt.attempt, resp)
+				if ok != tt.ok || delay < tt.min || delay > tt.max {
+					t.Fatalf("expected a delay between %s and %s and %t, got (%s, %t)", tt.min, tt.max, tt.ok, delay, ok)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,535 @@
+package spotifytest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/zmb3/spotify"
+)
+
+const (
+	AccessToken  = "fake-access-token"
+	RefreshToken = "fake-refresh-token"
+	AuthCode     = "fake-auth-code"
+
+	defaultPageSize = 20
+)
+
+type Server struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	user       *spotify.PrivateUser
+	scope      string
+	tracks     map[spotify.ID]spotify.FullTrack
+	topTracks  map[string][]spotify.ID
+	topArtists map[string][]spotify.FullArtist
+	playlists  []*playlist
+}
+
+type playlist struct {
+	id            spotify.ID
+	owner         string
+	name          string
+	description   string
+	public        bool
+	collaborative bool
+	trackIDs      []spotify.ID
+	snapshot      int
+	image         bool
+}
+
+func NewServer(user *spotify.PrivateUser, scopes ...string) *Server {
+	s := &Server{
+		user:       user,
+		scope:      strings.Join(scopes, " "),
+		tracks:     make(map[spotify.ID]spotify.FullTrack),
+		topTracks:  make(map[string][]spotify.ID),
+		topArtists: make(map[string][]spotify.FullArtist),
+	}
+
+	s.Server = httptest.NewServer(s.router())
+	return s
+}
+
+func (s *Server) router() http.Handler {
+	router := mux.NewRouter()
+
+	router.HandleFunc("/authorize", s.authorize()).Methods(http.MethodGet)
+	router.HandleFunc("/api/token", s.token()).Methods(http.MethodPost)
+
+	api := router.PathPrefix("/v1").Subrouter()
+	api.Use(s.middlewareAuthenticate)
+	api.HandleFunc("/me", s.currentUser()).Methods(http.MethodGet)
+	api.HandleFunc("/me/top/tracks", s.currentUsersTopTracks()).Methods(http.MethodGet)
+	api.HandleFunc("/me/top/artists", s.currentUsersTopArtists()).Methods(http.MethodGet)
+	api.HandleFunc("/me/playlists", s.currentUsersPlaylists()).Methods(http.MethodGet)
+	api.HandleFunc("/tracks", s.getTracks()).Methods(http.MethodGet)
+	api.HandleFunc("/users/{userID}/playlists", s.createPlaylist()).Methods(http.MethodPost)
+	api.HandleFunc("/playlists/{playlistID}", s.getPlaylist()).Methods(http.MethodGet)
+	api.HandleFunc("/playlists/{playlistID}/tracks", s.addTracks()).Methods(http.MethodPost)
+	api.HandleFunc("/playlists/{playlistID}/tracks", s.replaceTracks()).Methods(http.MethodPut)
+	api.HandleFunc("/playlists/{playlistID}/images", s.setImage()).Methods(http.MethodPut)
+
+	return router
+}
+
+// Transport sends requests meant for the Spotify API and accounts service to the fake server instead
+func (s *Server) Transport() http.RoundTripper {
+	target, _ := url.Parse(s.URL)
+	return &redirectTransport{
+		target: target,
+		base:   s.Client().Transport,
+	}
+}
+
+type redirectTransport struct {
+	target *url.URL
+	base   http.RoundTripper
+}
+
+func (t *redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch req.URL.Host {
+	case "api.spotify.com", "accounts.spotify.com":
+		r := req.Clone(req.Context())
+		r.URL.Scheme = t.target.Scheme
+		r.URL.Host = t.target.Host
+		r.Host = t.target.Host
+		return t.base.RoundTrip(r)
+	default:
+		return t.base.RoundTrip(req)
+	}
+}
+
+func (s *Server) AddTracks(tracks ...spotify.FullTrack) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, track := range tracks {
+		s.tracks[track.ID] = track
+	}
+}
+
+func (s *Server) SetTopTracks(timerange string, trackIDs ...spotify.ID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.topTracks[timerange] = trackIDs
+}
+
+func (s *Server) SetTopArtists(timerange string, artists ...spotify.FullArtist) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.topArtists[timerange] = artists
+}
+
+func (s *Server) PlaylistCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.playlists)
+}
+
+func (s *Server) PlaylistTracks(playlistID spotify.ID) ([]spotify.ID, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.findPlaylist(playlistID)
+	if !ok {
+		return nil, false
+	}
+
+	trackIDs := make([]spotify.ID, len(p.trackIDs))
+	copy(trackIDs, p.trackIDs)
+	return trackIDs, true
+}
+
+func (s *Server) authorize() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		redirectURL, err := url.Parse(r.URL.Query().Get("redirect_uri"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid redirect_uri")
+			return
+		}
+
+		query := redirectURL.Query()
+		query.Set("code", AuthCode)
+		query.Set("state", r.URL.Query().Get("state"))
+		redirectURL.RawQuery = query.Encode()
+
+		http.Redirect(w, r, redirectURL.String(), http.StatusFound)
+	}
+}
+
+func (s *Server) token() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := r.ParseForm()
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid form")
+			return
+		}
+
+		switch r.PostForm.Get("grant_type") {
+		case "authorization_code":
+			if r.PostForm.Get("code") != AuthCode {
+				writeError(w, http.StatusBadRequest, "invalid code")
+				return
+			}
+		case "refresh_token":
+			if r.PostForm.Get("refresh_token") != RefreshToken {
+				writeError(w, http.StatusBadRequest, "invalid refresh token")
+				return
+			}
+		default:
+			writeError(w, http.StatusBadRequest, "unsupported grant type")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"access_token":  AccessToken,
+			"token_type":    "Bearer",
+			"expires_in":    3600,
+			"refresh_token": RefreshToken,
+			"scope":         s.scope,
+		})
+	}
+}
+
+func (s *Server) middlewareAuthenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+AccessToken {
+			writeError(w, http.StatusUnauthorized, "invalid access token")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) currentUser() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.user)
+	}
+}
+
+func (s *Server) currentUsersTopTracks() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		trackIDs := s.topTracks[timerange(r)]
+		tracks := make([]spotify.FullTrack, len(trackIDs))
+		for idx, id := range trackIDs {
+			tracks[idx] = s.tracks[id]
+		}
+
+		offset, limit := paging(r)
+		start, end := bounds(len(tracks), offset, limit)
+		writeJSON(w, http.StatusOK, newPage(r, tracks[start:end], offset, limit, len(tracks)))
+	}
+}
+
+func (s *Server) currentUsersTopArtists() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		artists := s.topArtists[timerange(r)]
+
+		offset, limit := paging(r)
+		start, end := bounds(len(artists), offset, limit)
+		writeJSON(w, http.StatusOK, newPage(r, artists[start:end], offset, limit, len(artists)))
+	}
+}
+
+func (s *Server) currentUsersPlaylists() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		// newly created playlists are listed first, as they are on Spotify
+		playlists := make([]interface{}, len(s.playlists))
+		for idx, p := range s.playlists {
+			playlists[len(s.playlists)-1-idx] = s.simplePlaylist(p)
+		}
+
+		offset, limit := paging(r)
+		start, end := bounds(len(playlists), offset, limit)
+		writeJSON(w, http.StatusOK, newPage(r, playlists[start:end], offset, limit, len(playlists)))
+	}
+}
+
+func (s *Server) getTracks() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		var tracks []interface{}
+		for _, id := range strings.Split(r.URL.Query().Get("ids"), ",") {
+			track, ok := s.tracks[spotify.ID(id)]
+			if !ok {
+				tracks = append(tracks, nil)
+				continue
+			}
+			tracks = append(tracks, track)
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"tracks": tracks,
+		})
+	}
+}
+
+func (s *Server) createPlaylist() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Name          string `json:"name"`
+			Description   string `json:"description"`
+			Public        bool   `json:"public"`
+			Collaborative bool   `json:"collaborative"`
+		}
+
+		err := json.NewDecoder(r.Body).Decode(&body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid body")
+			return
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		p := &playlist{
+			id:            spotify.ID(fmt.Sprintf("playlist%d", len(s.playlists)+1)),
+			owner:         mux.Vars(r)["userID"],
+			name:          body.Name,
+			description:   body.Description,
+			public:        body.Public,
+			collaborative: body.Collaborative,
+			snapshot:      1,
+		}
+		s.playlists = append(s.playlists, p)
+
+		writeJSON(w, http.StatusCreated, s.fullPlaylist(p))
+	}
+}
+
+func (s *Server) getPlaylist() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		p, ok := s.findPlaylist(spotify.ID(mux.Vars(r)["playlistID"]))
+		if !ok {
+			writeError(w, http.StatusNotFound, "playlist not found")
+			return
+		}
+
+		writeJSON(w, http.StatusOK, s.fullPlaylist(p))
+	}
+}
+
+func (s *Server) addTracks() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			URIs []string `json:"uris"`
+		}
+
+		err := json.NewDecoder(r.Body).Decode(&body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid body")
+			return
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		p, ok := s.findPlaylist(spotify.ID(mux.Vars(r)["playlistID"]))
+		if !ok {
+			writeError(w, http.StatusNotFound, "playlist not found")
+			return
+		}
+
+		p.trackIDs = append(p.trackIDs, trackIDs(body.URIs)...)
+		p.snapshot++
+
+		writeJSON(w, http.StatusCreated, map[string]string{
+			"snapshot_id": snapshotID(p),
+		})
+	}
+}
+
+func (s *Server) replaceTracks() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var uris []string
+		if value := r.URL.Query().Get("uris"); value != "" {
+			uris = strings.Split(value, ",")
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		p, ok := s.findPlaylist(spotify.ID(mux.Vars(r)["playlistID"]))
+		if !ok {
+			writeError(w, http.StatusNotFound, "playlist not found")
+			return
+		}
+
+		p.trackIDs = trackIDs(uris)
+		p.snapshot++
+
+		writeJSON(w, http.StatusCreated, map[string]string{
+			"snapshot_id": snapshotID(p),
+		})
+	}
+}
+
+func (s *Server) setImage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		p, ok := s.findPlaylist(spotify.ID(mux.Vars(r)["playlistID"]))
+		if !ok {
+			writeError(w, http.StatusNotFound, "playlist not found")
+			return
+		}
+
+		p.image = true
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+func (s *Server) findPlaylist(playlistID spotify.ID) (*playlist, bool) {
+	for _, p := range s.playlists {
+		if p.id == playlistID {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+func (s *Server) simplePlaylist(p *playlist) map[string]interface{} {
+	return map[string]interface{}{
+		"id":            p.id,
+		"name":          p.name,
+		"public":        p.public,
+		"collaborative": p.collaborative,
+		"owner":         map[string]string{"id": p.owner},
+		"external_urls": map[string]string{"spotify": "https://open.spotify.com/playlist/" + string(p.id)},
+		"snapshot_id":   snapshotID(p),
+		"tracks": map[string]interface{}{
+			"total": len(p.trackIDs),
+		},
+	}
+}
+
+func (s *Server) fullPlaylist(p *playlist) map[string]interface{} {
+	items := make([]interface{}, len(p.trackIDs))
+	for idx, id := range p.trackIDs {
+		items[idx] = map[string]interface{}{
+			"track": s.tracks[id],
+		}
+	}
+
+	full := s.simplePlaylist(p)
+	full["description"] = p.description
+	full["tracks"] = map[string]interface{}{
+		"items":  items,
+		"limit":  len(items),
+		"offset": 0,
+		"total":  len(items),
+	}
+
+	return full
+}
+
+func snapshotID(p *playlist) string {
+	return fmt.Sprintf("%s-snapshot%d", p.id, p.snapshot)
+}
+
+func trackIDs(uris []string) []spotify.ID {
+	ids := make([]spotify.ID, len(uris))
+	for idx, uri := range uris {
+		ids[idx] = spotify.ID(strings.TrimPrefix(uri, "spotify:track:"))
+	}
+	return ids
+}
+
+func timerange(r *http.Request) string {
+	tr := strings.TrimSuffix(r.URL.Query().Get("time_range"), "_term")
+	if tr == "" {
+		return "medium"
+	}
+	return tr
+}
+
+func paging(r *http.Request) (int, int) {
+	offset, err := strconv.Atoi(r.URL.Query().Get("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultPageSize
+	}
+
+	return offset, limit
+}
+
+func bounds(total, offset, limit int) (int, int) {
+	start := offset
+	if start > total {
+		start = total
+	}
+
+	end := start + limit
+	if end > total {
+		end = total
+	}
+
+	return start, end
+}
+
+func newPage(r *http.Request, items interface{}, offset, limit, total int) map[string]interface{} {
+	var next string
+	if offset+limit < total {
+		nextURL := *r.URL
+		query := nextURL.Query()
+		query.Set("offset", strconv.Itoa(offset+limit))
+		query.Set("limit", strconv.Itoa(limit))
+		nextURL.RawQuery = query.Encode()
+		next = "https://api.spotify.com" + nextURL.RequestURI()
+	}
+
+	return map[string]interface{}{
+		"items":  items,
+		"limit":  limit,
+		"offset": offset,
+		"total":  total,
+		"next":   next,
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"error": map[string]interface{}{
+			"status":  status,
+			"message": message,
+		},
+	})
+}
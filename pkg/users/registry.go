@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/jace-ys/go-library/postgres"
@@ -21,16 +22,38 @@ var (
 type User struct {
 	*spotify.PrivateUser
 	*oauth2.Token
+	Scope     string
 	CreatedAt time.Time
 }
 
 func NewUser(spotifyUser *spotify.PrivateUser, token *oauth2.Token) *User {
+	scope, _ := token.Extra("scope").(string)
 	return &User{
 		PrivateUser: spotifyUser,
 		Token:       token,
+		Scope:       scope,
 	}
 }
 
+func (u *User) HasScopes(scopes ...string) bool {
+	granted := make(map[string]bool)
+	for _, scope := range strings.Fields(u.Scope) {
+		granted[scope] = true
+	}
+
+	for _, scope := range scopes {
+		if !granted[scope] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (u *User) FirstName() string {
+	return strings.SplitN(u.DisplayName, " ", 2)[0]
+}
+
 type Registry struct {
 	database *postgres.Client
 }
@@ -45,7 +68,7 @@ func (r *Registry) Get(ctx context.Context, userID string) (*User, error) {
 	var user User
 	err := r.database.Transact(ctx, func(tx *sqlx.Tx) error {
 		query := `
-		SELECT id, email, display_name, access_token, refresh_token, token_type, expiry, created_at
+		SELECT id, email, display_name, access_token, refresh_token, token_type, expiry, scope, created_at
 		FROM users
 		WHERE id = $1
 		`
@@ -67,8 +90,8 @@ func (r *Registry) Get(ctx context.Context, userID string) (*User, error) {
 func (r *Registry) Create(ctx context.Context, user *User) (string, error) {
 	err := r.database.Transact(ctx, func(tx *sqlx.Tx) error {
 		query := `
-		INSERT INTO users (id, email, display_name, access_token, refresh_token, token_type, expiry)
-		VALUES (:id, :email, :display_name, :access_token, :refresh_token, :token_type, :expiry)
+		INSERT INTO users (id, email, display_name, access_token, refresh_token, token_type, expiry, scope)
+		VALUES (:id, :email, :display_name, :access_token, :refresh_token, :token_type, :expiry, :scope)
 		RETURNING id
 		`
 		stmt, err := tx.PrepareNamedContext(ctx, query)
@@ -94,8 +117,8 @@ func (r *Registry) Create(ctx context.Context, user *User) (string, error) {
 func (r *Registry) CreateOrUpdate(ctx context.Context, user *User) (string, error) {
 	err := r.database.Transact(ctx, func(tx *sqlx.Tx) error {
 		query := `
-		INSERT INTO users (id, email, display_name, access_token, refresh_token, token_type, expiry)
-		VALUES (:id, :email, :display_name, :access_token, :refresh_token, :token_type, :expiry)
+		INSERT INTO users (id, email, display_name, access_token, refresh_token, token_type, expiry, scope)
+		VALUES (:id, :email, :display_name, :access_token, :refresh_token, :token_type, :expiry, :scope)
 		ON CONFLICT (id)
 		DO UPDATE SET
 			email = EXCLUDED.email,
@@ -103,7 +126,8 @@ func (r *Registry) CreateOrUpdate(ctx context.Context, user *User) (string, erro
 			access_token = EXCLUDED.access_token,
 			refresh_token = EXCLUDED.refresh_token,
 			token_type = EXCLUDED.token_type,
-			expiry = EXCLUDED.expiry
+			expiry = EXCLUDED.expiry,
+			scope = EXCLUDED.scope
 		RETURNING id
 		`
 		stmt, err := tx.PrepareNamedContext(ctx, query)
@@ -129,7 +153,8 @@ func (r *Registry) Update(ctx context.Context, user *User) (string, error) {
 			access_token = :access_token,
 			refresh_token = :refresh_token,
 			token_type = :token_type,
-			expiry = :expiry
+			expiry = :expiry,
+			scope = :scope
 		WHERE id = :id
 		RETURNING id
 		`